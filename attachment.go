@@ -0,0 +1,97 @@
+package imap
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/mail"
+)
+
+// Attachment is a part of a message with a file name or an attachment
+// disposition.
+type Attachment struct {
+	// Number is the IMAP part number, as in "2" or "1.3".
+	Number      string
+	Filename    string
+	ContentType string
+	// Size is the size in bytes of the decoded content, or of the encoded
+	// content if the attachment was only listed from a BODYSTRUCTURE.
+	Size int64
+	// Body reads the content with its transfer encoding removed. It is nil
+	// for attachments listed from a BODYSTRUCTURE.
+	Body io.Reader
+}
+
+// Attachments returns the attachments of msg, reading their content into
+// memory.
+func Attachments(msg *mail.Message) ([]*Attachment, error) {
+	var attachments []*Attachment
+	err := WalkMessage(msg, func(p *Part) error {
+		disposition, dispParams, _ := mime.ParseMediaType(p.Header.Get("Content-Disposition"))
+		filename := attachmentName(p.Params, dispParams)
+		if disposition != "attachment" && filename == "" {
+			return nil
+		}
+		data, err := ioutil.ReadAll(p.Body)
+		if err != nil {
+			return err
+		}
+		attachments = append(attachments, &Attachment{
+			Number:      p.Number,
+			Filename:    filename,
+			ContentType: p.MediaType,
+			Size:        int64(len(data)),
+			Body:        bytes.NewReader(data),
+		})
+		return nil
+	})
+	return attachments, err
+}
+
+// attachmentName returns the file name given by the Content-Disposition
+// filename or, for older mailers, the Content-Type name parameter. The
+// MIME parser already decoded RFC 2231 parameters; RFC 2047 encoded
+// words, common although not allowed there, are decoded here.
+func attachmentName(params, dispParams map[string]string) string {
+	name := dispParams["filename"]
+	if name == "" {
+		name = params["name"]
+	}
+	return DecodeHeader(name)
+}
+
+// Attachments lists the attachments described by bs without their
+// content.
+func (bs *BodyStructure) Attachments() []*Attachment {
+	var attachments []*Attachment
+	bs.walk("", func(number string, part *BodyStructure) error {
+		filename := attachmentName(part.Params, part.DispositionParams)
+		if part.Disposition != "attachment" && filename == "" {
+			return nil
+		}
+		attachments = append(attachments, &Attachment{
+			Number:      number,
+			Filename:    filename,
+			ContentType: part.MediaType(),
+			Size:        int64(part.Size),
+		})
+		return nil
+	})
+	return attachments
+}
+
+func (c *IMAPClient) ListAttachments(uid UID) ([]*Attachment, error) {
+	return c.ListAttachmentsContext(context.Background(), uid)
+}
+
+// ListAttachmentsContext lists the attachments of the message with the
+// given UID from its BODYSTRUCTURE, without fetching any content.
+func (c *IMAPClient) ListAttachmentsContext(ctx context.Context, uid UID) ([]*Attachment, error) {
+	bs, err := c.bodyStructure(ctx, uid)
+	if err != nil {
+		return nil, err
+	}
+	return bs.Attachments(), nil
+}
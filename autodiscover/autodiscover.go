@@ -0,0 +1,313 @@
+// Package autodiscover finds the IMAP settings for an email address using
+// Thunderbird autoconfig, the Mozilla ISPDB and Microsoft autodiscover.
+package autodiscover
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/xml"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/aniljava/imap"
+)
+
+const (
+	SocketSSL      = "SSL"
+	SocketSTARTTLS = "STARTTLS"
+	SocketPlain    = "plain"
+)
+
+// Config is the IMAP part of a discovered account configuration.
+type Config struct {
+	Host       string
+	Port       int
+	SocketType string
+	Username   string
+	// Authentication holds the mechanisms hinted by the source, such as
+	// "password-cleartext" or "OAuth2". It may be empty.
+	Authentication []string
+	// Source is the URL the configuration was read from.
+	Source string
+}
+
+func (c *Config) Addr() string {
+	return net.JoinHostPort(c.Host, strconv.Itoa(c.Port))
+}
+
+// tlsConfig returns a copy of config (which may be nil) for the server of
+// c, taking its ServerName from c.Host unless set.
+func (c *Config) tlsConfig(config *tls.Config) *tls.Config {
+	if config == nil {
+		return &tls.Config{ServerName: c.Host}
+	}
+	config = config.Clone()
+	if config.ServerName == "" {
+		config.ServerName = c.Host
+	}
+	return config
+}
+
+type Discoverer struct {
+	// HTTPClient is used for all requests. Nil means http.DefaultClient.
+	HTTPClient *http.Client
+	// ISPDB is the base URL of the Mozilla ISP database. Empty means
+	// DefaultISPDB; "-" disables it.
+	ISPDB string
+}
+
+const DefaultISPDB = "https://autoconfig.thunderbird.net/v1.1/"
+
+var ErrNotFound = errors.New("autodiscover: no IMAP configuration found")
+
+func Lookup(ctx context.Context, email string) ([]Config, error) {
+	var d Discoverer
+	return d.Lookup(ctx, email)
+}
+
+func Dial(ctx context.Context, email string, dialer *imap.Dialer, config *tls.Config) (*imap.IMAPClient, *Config, error) {
+	var d Discoverer
+	return d.Dial(ctx, email, dialer, config)
+}
+
+// Lookup tries the provider's autoconfig server, its well-known URL, the
+// ISPDB and finally Microsoft autodiscover, returning the IMAP servers of
+// the first source that knows the domain.
+func (d *Discoverer) Lookup(ctx context.Context, email string) ([]Config, error) {
+	i := strings.LastIndex(email, "@")
+	if i < 0 {
+		return nil, errors.New("autodiscover: invalid email address " + email)
+	}
+	domain := email[i+1:]
+
+	urls := []string{
+		"https://autoconfig." + domain + "/mail/config-v1.1.xml?emailaddress=" + url.QueryEscape(email),
+		"https://" + domain + "/.well-known/autoconfig/mail/config-v1.1.xml",
+	}
+	switch d.ISPDB {
+	case "":
+		urls = append(urls, DefaultISPDB+url.PathEscape(domain))
+	case "-":
+	default:
+		urls = append(urls, strings.TrimSuffix(d.ISPDB, "/")+"/"+url.PathEscape(domain))
+	}
+	for _, u := range urls {
+		configs, err := d.autoconfig(ctx, u, email)
+		if err == nil && len(configs) > 0 {
+			return configs, nil
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+	}
+
+	for _, u := range []string{
+		"https://autodiscover." + domain + "/autodiscover/autodiscover.xml",
+		"https://" + domain + "/autodiscover/autodiscover.xml",
+	} {
+		configs, err := d.autodiscover(ctx, u, email)
+		if err == nil && len(configs) > 0 {
+			return configs, nil
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// Dial looks up the settings for email and connects to the first server
+// that accepts a connection, upgrading with STARTTLS where required.
+func (d *Discoverer) Dial(ctx context.Context, email string, dialer *imap.Dialer, config *tls.Config) (*imap.IMAPClient, *Config, error) {
+	configs, err := d.Lookup(ctx, email)
+	if err != nil {
+		return nil, nil, err
+	}
+	if dialer == nil {
+		dialer = &imap.Dialer{}
+	}
+	for i := range configs {
+		cfg := &configs[i]
+		var c *imap.IMAPClient
+		switch cfg.SocketType {
+		case SocketSSL:
+			c, err = dialer.DialTLSContext(ctx, cfg.Addr(), cfg.tlsConfig(config))
+		case SocketSTARTTLS:
+			c, err = dialer.DialStartTLSContext(ctx, cfg.Addr(), cfg.tlsConfig(config))
+		default:
+			c, err = dialer.DialContext(ctx, cfg.Addr())
+		}
+		if err == nil {
+			return c, cfg, nil
+		}
+	}
+	return nil, nil, err
+}
+
+func (d *Discoverer) client() *http.Client {
+	if d.HTTPClient != nil {
+		return d.HTTPClient
+	}
+	return http.DefaultClient
+}
+
+func (d *Discoverer) fetch(req *http.Request) ([]byte, error) {
+	resp, err := d.client().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.New("autodiscover: " + req.URL.String() + ": " + resp.Status)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+}
+
+type clientConfig struct {
+	Servers []struct {
+		Type           string   `xml:"type,attr"`
+		Hostname       string   `xml:"hostname"`
+		Port           int      `xml:"port"`
+		SocketType     string   `xml:"socketType"`
+		Username       string   `xml:"username"`
+		Authentication []string `xml:"authentication"`
+	} `xml:"emailProvider>incomingServer"`
+}
+
+func (d *Discoverer) autoconfig(ctx context.Context, u, email string) ([]Config, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", u, nil)
+	if err != nil {
+		return nil, err
+	}
+	data, err := d.fetch(req)
+	if err != nil {
+		return nil, err
+	}
+	var cc clientConfig
+	if err := xml.Unmarshal(data, &cc); err != nil {
+		return nil, err
+	}
+
+	local, domain := email, ""
+	if i := strings.LastIndex(email, "@"); i >= 0 {
+		local, domain = email[:i], email[i+1:]
+	}
+	expand := strings.NewReplacer(
+		"%EMAILADDRESS%", email,
+		"%EMAILLOCALPART%", local,
+		"%EMAILDOMAIN%", domain,
+	)
+
+	var configs []Config
+	for _, s := range cc.Servers {
+		if s.Type != "imap" {
+			continue
+		}
+		if !validPort(s.Port) {
+			continue
+		}
+		socketType := s.SocketType
+		if socketType == "" {
+			socketType = SocketPlain
+		}
+		configs = append(configs, Config{
+			Host:           expand.Replace(s.Hostname),
+			Port:           s.Port,
+			SocketType:     socketType,
+			Username:       expand.Replace(s.Username),
+			Authentication: s.Authentication,
+			Source:         u,
+		})
+	}
+	return configs, nil
+}
+
+const autodiscoverRequest = `<?xml version="1.0" encoding="utf-8"?>
+<Autodiscover xmlns="http://schemas.microsoft.com/exchange/autodiscover/outlook/requestschema/2006">
+  <Request>
+    <EMailAddress>%s</EMailAddress>
+    <AcceptableResponseSchema>http://schemas.microsoft.com/exchange/autodiscover/outlook/responseschema/2006a</AcceptableResponseSchema>
+  </Request>
+</Autodiscover>`
+
+type autodiscoverResponse struct {
+	Protocols []struct {
+		Type       string `xml:"Type"`
+		Server     string `xml:"Server"`
+		Port       int    `xml:"Port"`
+		SSL        string `xml:"SSL"`
+		Encryption string `xml:"Encryption"`
+		LoginName  string `xml:"LoginName"`
+	} `xml:"Response>Account>Protocol"`
+}
+
+func (d *Discoverer) autodiscover(ctx context.Context, u, email string) ([]Config, error) {
+	var body bytes.Buffer
+	xml.EscapeText(&body, []byte(email))
+	payload := strings.Replace(autodiscoverRequest, "%s", body.String(), 1)
+	req, err := http.NewRequestWithContext(ctx, "POST", u, strings.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "text/xml")
+	data, err := d.fetch(req)
+	if err != nil {
+		return nil, err
+	}
+	var ar autodiscoverResponse
+	if err := xml.Unmarshal(data, &ar); err != nil {
+		return nil, err
+	}
+
+	var configs []Config
+	for _, p := range ar.Protocols {
+		if !strings.EqualFold(p.Type, "IMAP") {
+			continue
+		}
+		socketType := SocketSSL
+		switch strings.ToUpper(p.Encryption) {
+		case "TLS":
+			socketType = SocketSTARTTLS
+		case "NONE":
+			socketType = SocketPlain
+		case "":
+			if strings.EqualFold(p.SSL, "off") {
+				socketType = SocketPlain
+			}
+		}
+		port := p.Port
+		if port == 0 {
+			port, _ = strconv.Atoi(imap.DefaultTLSPort)
+			if socketType != SocketSSL {
+				port, _ = strconv.Atoi(imap.DefaultPort)
+			}
+		}
+		if !validPort(port) {
+			continue
+		}
+		username := p.LoginName
+		if username == "" {
+			username = email
+		}
+		configs = append(configs, Config{
+			Host:       p.Server,
+			Port:       port,
+			SocketType: socketType,
+			Username:   username,
+			Source:     u,
+		})
+	}
+	return configs, nil
+}
+
+// validPort reports whether port can be dialled; servers whose
+// configuration lacks one are left out.
+func validPort(port int) bool {
+	return port > 0 && port <= 0xffff
+}
@@ -0,0 +1,74 @@
+package autodiscover
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+type roundTripper func(req *http.Request) (*http.Response, error)
+
+func (f roundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// testDiscoverer returns a Discoverer whose ISPDB answers with body and
+// every other source with 404, recording the ISPDB paths requested.
+func testDiscoverer(body string, paths *[]string) *Discoverer {
+	return &Discoverer{
+		ISPDB: "https://ispdb.test/v1.1/",
+		HTTPClient: &http.Client{Transport: roundTripper(func(req *http.Request) (*http.Response, error) {
+			resp := &http.Response{StatusCode: http.StatusNotFound, Status: "404 Not Found", Body: io.NopCloser(strings.NewReader(""))}
+			if req.URL.Host == "ispdb.test" {
+				*paths = append(*paths, req.URL.EscapedPath())
+				resp.StatusCode, resp.Status = http.StatusOK, "200 OK"
+				resp.Body = io.NopCloser(strings.NewReader(body))
+			}
+			return resp, nil
+		})},
+	}
+}
+
+func TestLookupISPDB(t *testing.T) {
+	body := `<clientConfig><emailProvider>
+		<incomingServer type="imap"><hostname>broken.example.com</hostname><socketType>SSL</socketType></incomingServer>
+		<incomingServer type="imap"><hostname>imap.example.com</hostname><port>993</port><socketType>SSL</socketType><username>%EMAILLOCALPART%</username></incomingServer>
+		<incomingServer type="pop3"><hostname>pop.example.com</hostname><port>995</port></incomingServer>
+	</emailProvider></clientConfig>`
+	var paths []string
+	configs, err := testDiscoverer(body, &paths).Lookup(context.Background(), "user@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(configs) != 1 || configs[0].Addr() != "imap.example.com:993" || configs[0].Username != "user" {
+		t.Errorf("got %+v, want only the IMAP server with a port", configs)
+	}
+	if len(paths) != 1 || paths[0] != "/v1.1/example.com" {
+		t.Errorf("got ISPDB paths %q", paths)
+	}
+}
+
+func TestLookupISPDBEscapesDomain(t *testing.T) {
+	var paths []string
+	testDiscoverer("<clientConfig/>", &paths).Lookup(context.Background(), "user@a/../b?c")
+	if len(paths) != 1 || paths[0] != "/v1.1/a%2F..%2Fb%3Fc" {
+		t.Errorf("got ISPDB paths %q", paths)
+	}
+}
+
+func TestConfigTLS(t *testing.T) {
+	cfg := &Config{Host: "imap.example.com", Port: 143}
+	if got := cfg.tlsConfig(nil).ServerName; got != "imap.example.com" {
+		t.Errorf("nil config: got %q", got)
+	}
+	shared := &tls.Config{MinVersion: tls.VersionTLS12}
+	if got := cfg.tlsConfig(shared); got.ServerName != "imap.example.com" || got.MinVersion != tls.VersionTLS12 || shared.ServerName != "" {
+		t.Errorf("got %q, shared config now %q", got.ServerName, shared.ServerName)
+	}
+	if got := cfg.tlsConfig(&tls.Config{ServerName: "other"}).ServerName; got != "other" {
+		t.Errorf("explicit name: got %q", got)
+	}
+}
@@ -0,0 +1,146 @@
+package imap
+
+import (
+	"errors"
+	"strings"
+)
+
+// BodyStructure describes the MIME structure of a message or of one of its
+// parts, as returned by FETCH BODYSTRUCTURE. Type, subtype, encoding,
+// disposition and parameter names are lower cased.
+type BodyStructure struct {
+	MIMEType    string
+	MIMESubType string
+	Params      map[string]string
+	ID          string
+	Description string
+	Encoding    string
+	Size        uint32
+	// Lines is the size in lines of text parts and message/rfc822 parts.
+	Lines uint32
+
+	// Parts are the children of a multipart, or the single body of a
+	// message/rfc822 part.
+	Parts []*BodyStructure
+	// Envelope is the envelope of a message/rfc822 part.
+	Envelope *Envelope
+
+	// The extension data below is only sent for BODYSTRUCTURE, not BODY.
+	MD5               string
+	Disposition       string
+	DispositionParams map[string]string
+	Language          []string
+	Location          string
+}
+
+// MediaType returns the type and subtype as in "text/plain".
+func (bs *BodyStructure) MediaType() string {
+	return bs.MIMEType + "/" + bs.MIMESubType
+}
+
+func parseBodyStructure(field interface{}) (*BodyStructure, error) {
+	fields := asList(field)
+	if len(fields) == 0 {
+		return nil, errors.New("Invalid BODYSTRUCTURE")
+	}
+	bs := &BodyStructure{}
+	if _, ok := fields[0].([]interface{}); ok {
+		bs.MIMEType = "multipart"
+		i := 0
+		for ; i < len(fields); i++ {
+			if _, ok := fields[i].([]interface{}); !ok {
+				break
+			}
+			part, err := parseBodyStructure(fields[i])
+			if err != nil {
+				return nil, err
+			}
+			bs.Parts = append(bs.Parts, part)
+		}
+		if i == len(fields) {
+			return nil, errors.New("Invalid BODYSTRUCTURE, missing multipart subtype")
+		}
+		bs.MIMESubType = strings.ToLower(asString(fields[i]))
+		ext := fields[i+1:]
+		if len(ext) > 0 {
+			bs.Params = parseBodyParams(ext[0])
+			ext = ext[1:]
+		}
+		bs.parseExtension(ext)
+		return bs, nil
+	}
+
+	if len(fields) < 7 {
+		return nil, errors.New("Invalid BODYSTRUCTURE, too few fields")
+	}
+	bs.MIMEType = strings.ToLower(asString(fields[0]))
+	bs.MIMESubType = strings.ToLower(asString(fields[1]))
+	bs.Params = parseBodyParams(fields[2])
+	bs.ID = asString(fields[3])
+	bs.Description = asString(fields[4])
+	bs.Encoding = strings.ToLower(asString(fields[5]))
+	bs.Size, _ = asNumber(fields[6])
+	ext := fields[7:]
+	switch {
+	case bs.MIMEType == "message" && bs.MIMESubType == "rfc822" && len(ext) >= 3:
+		env, err := parseEnvelope(ext[0])
+		if err != nil {
+			return nil, err
+		}
+		part, err := parseBodyStructure(ext[1])
+		if err != nil {
+			return nil, err
+		}
+		bs.Envelope = env
+		bs.Parts = []*BodyStructure{part}
+		bs.Lines, _ = asNumber(ext[2])
+		ext = ext[3:]
+	case bs.MIMEType == "text" && len(ext) >= 1:
+		bs.Lines, _ = asNumber(ext[0])
+		ext = ext[1:]
+	}
+	if len(ext) > 0 {
+		bs.MD5 = asString(ext[0])
+		ext = ext[1:]
+	}
+	bs.parseExtension(ext)
+	return bs, nil
+}
+
+// parseExtension reads the disposition, language and location extension
+// data common to all parts.
+func (bs *BodyStructure) parseExtension(ext []interface{}) {
+	if len(ext) > 0 {
+		if disp := asList(ext[0]); len(disp) >= 1 {
+			bs.Disposition = strings.ToLower(asString(disp[0]))
+			if len(disp) >= 2 {
+				bs.DispositionParams = parseBodyParams(disp[1])
+			}
+		}
+	}
+	if len(ext) > 1 {
+		switch lang := ext[1].(type) {
+		case string:
+			bs.Language = []string{lang}
+		case []interface{}:
+			for _, l := range lang {
+				bs.Language = append(bs.Language, asString(l))
+			}
+		}
+	}
+	if len(ext) > 2 {
+		bs.Location = asString(ext[2])
+	}
+}
+
+func parseBodyParams(field interface{}) map[string]string {
+	list := asList(field)
+	if len(list) == 0 {
+		return nil
+	}
+	params := make(map[string]string)
+	for i := 0; i+1 < len(list); i += 2 {
+		params[strings.ToLower(asString(list[i]))] = asString(list[i+1])
+	}
+	return params
+}
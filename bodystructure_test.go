@@ -0,0 +1,82 @@
+package imap
+
+import (
+	"reflect"
+	"testing"
+)
+
+func parseBodyStructureString(t *testing.T, s string) (*BodyStructure, error) {
+	fields, err := parseFields(s)
+	if err != nil || len(fields) != 1 {
+		t.Fatalf("%q: %v", s, err)
+	}
+	return parseBodyStructure(fields[0])
+}
+
+func TestParseBodyStructure(t *testing.T) {
+	// The example of RFC 3501 section 7.4.2, with extension data.
+	s := `(("TEXT" "PLAIN" ("CHARSET" "US-ASCII") NIL NIL "7BIT" 1152 23 NIL NIL NIL NIL)` +
+		`("TEXT" "PLAIN" ("CHARSET" "US-ASCII" "NAME" "cc.diff") "<960723163407.20117h@cac.washington.edu>" "Compiler diff" "BASE64" 4554 73 NIL ("ATTACHMENT" ("FILENAME" "cc.diff")) "EN" NIL)` +
+		` "MIXED" ("BOUNDARY" "----- =_aaaaaaaaaa0") NIL ("de" "en") "http://example.com/")`
+	bs, err := parseBodyStructureString(t, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &BodyStructure{
+		MIMEType:    "multipart",
+		MIMESubType: "mixed",
+		Params:      map[string]string{"boundary": "----- =_aaaaaaaaaa0"},
+		Parts: []*BodyStructure{
+			{
+				MIMEType: "text", MIMESubType: "plain",
+				Params:   map[string]string{"charset": "US-ASCII"},
+				Encoding: "7bit", Size: 1152, Lines: 23,
+			},
+			{
+				MIMEType: "text", MIMESubType: "plain",
+				Params:      map[string]string{"charset": "US-ASCII", "name": "cc.diff"},
+				ID:          "<960723163407.20117h@cac.washington.edu>",
+				Description: "Compiler diff",
+				Encoding:    "base64", Size: 4554, Lines: 73,
+				Disposition:       "attachment",
+				DispositionParams: map[string]string{"filename": "cc.diff"},
+				Language:          []string{"EN"},
+			},
+		},
+		Language: []string{"de", "en"},
+		Location: "http://example.com/",
+	}
+	if !reflect.DeepEqual(bs, want) {
+		t.Errorf("got %+v", bs)
+	}
+}
+
+func TestParseBodyStructureMessage(t *testing.T) {
+	s := `("MESSAGE" "RFC822" NIL NIL NIL "7BIT" 342 ` +
+		`("Mon, 7 Feb 1994 21:52:25 -0800" "Fwd" (("Fred" NIL "fred" "example.com")) NIL NIL NIL NIL NIL NIL "<a@b>") ` +
+		`("TEXT" "HTML" NIL NIL NIL "QUOTED-PRINTABLE" 120 4) 12)`
+	bs, err := parseBodyStructureString(t, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bs.MediaType() != "message/rfc822" || bs.Lines != 12 || bs.Envelope == nil || bs.Envelope.Subject != "Fwd" {
+		t.Fatalf("got %+v", bs)
+	}
+	if len(bs.Parts) != 1 || bs.Parts[0].MediaType() != "text/html" || bs.Parts[0].Encoding != "quoted-printable" || bs.Parts[0].Lines != 4 {
+		t.Errorf("got part %+v", bs.Parts[0])
+	}
+}
+
+func TestParseBodyStructureErrors(t *testing.T) {
+	for _, s := range []string{
+		`()`,
+		`("TEXT" "PLAIN" NIL NIL NIL "7BIT")`,
+		`(("TEXT" "PLAIN" NIL NIL NIL "7BIT" 1 1))`,
+		`(("TEXT" "PLAIN" NIL NIL) "MIXED")`,
+		`("MESSAGE" "RFC822" NIL NIL NIL "7BIT" 342 ("date") ("TEXT" "PLAIN" NIL NIL NIL "7BIT" 1 1) 1)`,
+	} {
+		if bs, err := parseBodyStructureString(t, s); err == nil {
+			t.Errorf("%s: got %+v, want an error", s, bs)
+		}
+	}
+}
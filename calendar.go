@@ -0,0 +1,31 @@
+package imap
+
+import "context"
+
+func (c *IMAPClient) FetchCalendars(uid UID) ([][]byte, error) {
+	return c.FetchCalendarsContext(context.Background(), uid)
+}
+
+// FetchCalendarsContext fetches the text/calendar parts of the message with
+// the given UID, including those sent as application/ics attachments, and
+// returns their raw iCalendar data with the transfer encoding removed. It
+// returns nothing for messages without such parts.
+func (c *IMAPClient) FetchCalendarsContext(ctx context.Context, uid UID) ([][]byte, error) {
+	bs, err := c.bodyStructure(ctx, uid)
+	if err != nil {
+		return nil, err
+	}
+	var calendars [][]byte
+	err = bs.walk("", func(number string, part *BodyStructure) error {
+		if t := part.MediaType(); t != "text/calendar" && t != "application/ics" {
+			return nil
+		}
+		data, err := c.fetchPart(ctx, uid, number, part)
+		if err != nil {
+			return err
+		}
+		calendars = append(calendars, data)
+		return nil
+	})
+	return calendars, err
+}
@@ -0,0 +1,157 @@
+package imap
+
+import (
+	"context"
+	"strings"
+)
+
+// Capabilities is the set of capabilities a server advertises, keyed by
+// upper case name, such as "IMAP4REV1", "IDLE" or "AUTH=PLAIN".
+type Capabilities map[string]bool
+
+func (caps Capabilities) Has(name string) bool {
+	return caps[strings.ToUpper(name)]
+}
+
+// Auth returns the SASL mechanisms the server advertises.
+func (caps Capabilities) Auth() []string {
+	var mechs []string
+	for name := range caps {
+		if strings.HasPrefix(name, "AUTH=") {
+			mechs = append(mechs, name[len("AUTH="):])
+		}
+	}
+	return mechs
+}
+
+func parseCapabilities(names []string) Capabilities {
+	caps := make(Capabilities)
+	for _, name := range names {
+		caps[strings.ToUpper(name)] = true
+	}
+	return caps
+}
+
+func (c *IMAPClient) Capability() (Capabilities, error) {
+	return c.CapabilityContext(context.Background())
+}
+
+// CapabilityContext issues CAPABILITY and returns the result, which is
+// also cached for Supports. The cache is dropped after STARTTLS and
+// authentication, and refreshed from [CAPABILITY] response codes.
+func (c *IMAPClient) CapabilityContext(ctx context.Context) (Capabilities, error) {
+	resp := c.DoContext(ctx, "CAPABILITY")
+	if resp.Error() != nil {
+		return nil, resp.Error()
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.caps == nil {
+		c.caps = make(Capabilities)
+	}
+	return c.caps, nil
+}
+
+// Supports reports whether the server advertises the named capability,
+// asking it only if the capabilities are not cached.
+func (c *IMAPClient) Supports(name string) bool {
+	caps, err := c.capabilities(context.Background())
+	return err == nil && caps.Has(name)
+}
+
+// capabilities returns the cached capabilities, issuing CAPABILITY the
+// first time and after anything that may change them.
+func (c *IMAPClient) capabilities(ctx context.Context) (Capabilities, error) {
+	c.mu.Lock()
+	caps := c.caps
+	c.mu.Unlock()
+	if caps != nil {
+		return caps, nil
+	}
+	return c.CapabilityContext(ctx)
+}
+
+// updateCapabilities caches capabilities found in resp, either as an
+// untagged CAPABILITY response or a [CAPABILITY] response code.
+func (c *IMAPClient) updateCapabilities(resp *Response) {
+	for _, reply := range resp.Replys() {
+		fields := strings.Fields(reply.Origin())
+		if len(fields) == 0 {
+			continue
+		}
+		switch strings.ToUpper(fields[0]) {
+		case "CAPABILITY":
+			c.caps = parseCapabilities(fields[1:])
+		case "OK":
+			if code, args := responseCode(reply.Origin()[len(fields[0]):]); code == "CAPABILITY" {
+				c.caps = parseCapabilities(strings.Fields(args))
+			}
+		}
+	}
+	if resp.Error() == nil {
+		if code, args := responseCode(strings.TrimPrefix(resp.Status(), "OK")); code == "CAPABILITY" {
+			c.caps = parseCapabilities(strings.Fields(args))
+		}
+	}
+}
+
+// responseCode extracts the response code from the text of a status
+// response, as in "[UIDNEXT 4392] Predicted next UID", returning the upper
+// cased code and its arguments.
+func responseCode(text string) (code, args string) {
+	text = strings.TrimLeft(text, " ")
+	if !strings.HasPrefix(text, "[") {
+		return "", ""
+	}
+	end := strings.IndexByte(text, ']')
+	if end < 0 {
+		return "", ""
+	}
+	text = text[1:end]
+	if i := strings.IndexByte(text, ' '); i >= 0 {
+		return strings.ToUpper(text[:i]), text[i+1:]
+	}
+	return strings.ToUpper(text), ""
+}
+
+func (c *IMAPClient) Enable(names ...string) ([]string, error) {
+	return c.EnableContext(context.Background(), names...)
+}
+
+// EnableContext turns on the named extensions (RFC 5161), such as
+// CONDSTORE or QRESYNC, and returns those the server actually enabled.
+// Extensions stay enabled for the rest of the session; see Enabled.
+func (c *IMAPClient) EnableContext(ctx context.Context, names ...string) ([]string, error) {
+	args := []interface{}{"ENABLE"}
+	for _, name := range names {
+		args = append(args, name)
+	}
+	resp := c.command(ctx, args...)
+	if resp.Error() != nil {
+		return nil, resp.Error()
+	}
+	var enabled []string
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, reply := range resp.Replys() {
+		fields := strings.Fields(reply.Origin())
+		if len(fields) == 0 || !strings.EqualFold(fields[0], "ENABLED") {
+			continue
+		}
+		if c.enabled == nil {
+			c.enabled = make(Capabilities)
+		}
+		for _, name := range fields[1:] {
+			c.enabled[strings.ToUpper(name)] = true
+			enabled = append(enabled, name)
+		}
+	}
+	return enabled, nil
+}
+
+// Enabled reports whether the named extension was enabled with Enable.
+func (c *IMAPClient) Enabled(name string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.enabled.Has(name)
+}
@@ -0,0 +1,98 @@
+package imap
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/mail"
+	"strings"
+	"unicode/utf8"
+)
+
+// CharsetReader, if set, converts text in charsets this package does not
+// know to UTF-8. It is used for text parts and RFC 2047 encoded words.
+// Without it only UTF-8, US-ASCII, ISO-8859-1 and Windows-1252 are
+// supported. golang.org/x/net/html/charset.NewReaderLabel fits, as does
+// a wrapper around golang.org/x/text/encoding/htmlindex.
+var CharsetReader func(charset string, input io.Reader) (io.Reader, error)
+
+// DecodeCharset returns a reader that converts input from charset to
+// UTF-8.
+func DecodeCharset(charset string, input io.Reader) (io.Reader, error) {
+	switch strings.ToLower(strings.Trim(charset, `" `)) {
+	case "", "utf-8", "utf8", "us-ascii", "ascii":
+		return input, nil
+	case "iso-8859-1", "latin1", "latin-1":
+		return singleByteReader(input, nil)
+	case "windows-1252", "cp1252":
+		return singleByteReader(input, &windows1252)
+	}
+	if CharsetReader != nil {
+		return CharsetReader(charset, input)
+	}
+	return nil, errors.New("Unsupported charset " + charset)
+}
+
+// singleByteReader decodes a single byte charset whose bytes 0x80 to 0x9F
+// map to high, or to the same code points if high is nil, and all other
+// bytes to the same code points.
+func singleByteReader(input io.Reader, high *[32]rune) (io.Reader, error) {
+	data, err := ioutil.ReadAll(input)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	buf.Grow(len(data))
+	var enc [utf8.UTFMax]byte
+	for _, b := range data {
+		r := rune(b)
+		if high != nil && b >= 0x80 && b < 0xA0 {
+			r = high[b-0x80]
+		}
+		n := utf8.EncodeRune(enc[:], r)
+		buf.Write(enc[:n])
+	}
+	return &buf, nil
+}
+
+var windows1252 = [32]rune{
+	'€', 0x81, '‚', 'ƒ', '„', '…', '†', '‡', 'ˆ', '‰', 'Š', '‹', 'Œ', 0x8D, 'Ž', 0x8F,
+	0x90, '‘', '’', '“', '”', '•', '–', '—', '˜', '™', 'š', '›', 'œ', 0x9D, 'ž', 'Ÿ',
+}
+
+// Text reads the body of a text part converted to UTF-8 from the charset
+// it declares.
+func (p *Part) Text() (string, error) {
+	r, err := DecodeCharset(p.Params["charset"], p.Body)
+	if err != nil {
+		return "", err
+	}
+	data, err := ioutil.ReadAll(r)
+	return string(data), err
+}
+
+var wordDecoder = &mime.WordDecoder{CharsetReader: DecodeCharset}
+
+// DecodeHeader decodes RFC 2047 encoded words in s, as in
+// "=?UTF-8?B?w6l0w6k=?=", returning s unchanged if that fails.
+func DecodeHeader(s string) string {
+	if decoded, err := wordDecoder.DecodeHeader(s); err == nil {
+		return decoded
+	}
+	return s
+}
+
+// DecodeHeaders returns a copy of h with encoded words decoded in every
+// value. Address fields are best parsed from h itself with AddressList,
+// which decodes display names but would be confused by decoded commas.
+func DecodeHeaders(h mail.Header) mail.Header {
+	decoded := make(mail.Header, len(h))
+	for key, values := range h {
+		for _, v := range values {
+			decoded[key] = append(decoded[key], DecodeHeader(v))
+		}
+	}
+	return decoded
+}
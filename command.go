@@ -0,0 +1,155 @@
+package imap
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Literal is data sent to the server as an IMAP literal. *bytes.Reader,
+// *bytes.Buffer and *strings.Reader all implement it.
+type Literal interface {
+	io.Reader
+	Len() int
+}
+
+// Quoted is a string argument, such as a search term, as opposed to an
+// atom. It is sent as a quoted string, or as a literal if it contains 8-bit
+// characters or line breaks.
+type Quoted string
+
+// command runs a command made of args separated by spaces. Strings, which
+// must not contain control characters, and SeqSets are sent verbatim,
+// integers and UIDs in decimal, a time.Time as its date in DateLayout and
+// a time.Duration as whole seconds, at least 1, for OLDER and YOUNGER;
+// each Literal, and each Quoted that needs to be one, is announced as {n}
+// and sent once the server asks for it with a continuation request.
+// Where the server supports LITERAL+ (RFC 7888), literals are announced as
+// {n+} and sent right away instead, saving a round trip each; with
+// LITERAL-, only those of up to 4096 bytes. An argument of any other type
+// fails the command without sending it.
+func (c *IMAPClient) command(ctx context.Context, args ...interface{}) *Response {
+	c.mu.Lock()
+	caps := c.caps
+	c.mu.Unlock()
+	return c.commandCaps(ctx, caps, args...)
+}
+
+// isCTL reports whether r is a control character, which no bare argument
+// may contain.
+func isCTL(r rune) bool {
+	return r < ' ' || r == 0x7f
+}
+
+// maxLiteralMinus is the largest literal LITERAL- allows to be sent
+// without waiting.
+const maxLiteralMinus = 4096
+
+// commandCaps runs a command like command, taking the server's support
+// for non-synchronizing literals from caps rather than the cache, for
+// commands that drop it.
+func (c *IMAPClient) commandCaps(ctx context.Context, caps Capabilities, args ...interface{}) *Response {
+	var lines []string
+	var literals []Literal
+	var sync []bool
+	var line []string
+	for _, arg := range args {
+		if q, ok := arg.(Quoted); ok {
+			arg = quote(string(q))
+		}
+		switch arg := arg.(type) {
+		case string:
+			if strings.IndexFunc(arg, isCTL) >= 0 {
+				ret := NewResponse()
+				ret.err = errors.New("Invalid command argument " + strconv.Quote(arg))
+				return ret
+			}
+			line = append(line, arg)
+		case SeqSet:
+			line = append(line, arg.String())
+		case int:
+			line = append(line, strconv.Itoa(arg))
+		case int64:
+			line = append(line, strconv.FormatInt(arg, 10))
+		case uint32:
+			line = append(line, strconv.FormatUint(uint64(arg), 10))
+		case uint64:
+			line = append(line, strconv.FormatUint(arg, 10))
+		case UID:
+			line = append(line, strconv.FormatUint(uint64(arg), 10))
+		case time.Time:
+			line = append(line, arg.Format(DateLayout))
+		case time.Duration:
+			seconds := int64(arg / time.Second)
+			if seconds < 1 {
+				seconds = 1
+			}
+			line = append(line, strconv.FormatInt(seconds, 10))
+		case Literal:
+			n := arg.Len()
+			if caps.Has("LITERAL+") || caps.Has("LITERAL-") && n <= maxLiteralMinus {
+				line = append(line, "{"+strconv.Itoa(n)+"+}")
+				sync = append(sync, false)
+			} else {
+				line = append(line, "{"+strconv.Itoa(n)+"}")
+				sync = append(sync, true)
+			}
+			lines = append(lines, strings.Join(line, " "))
+			literals = append(literals, arg)
+			line = []string{""}
+		default:
+			ret := NewResponse()
+			ret.err = fmt.Errorf("Invalid command argument of type %T", arg)
+			return ret
+		}
+	}
+	lines = append(lines, strings.Join(line, " "))
+
+	if len(literals) == 0 {
+		return c.DoContext(ctx, lines[0])
+	}
+	// next sends the literals from i on, each followed by the command up
+	// to the next one, until one has to wait for a continuation request.
+	i := 0
+	next := func(w io.Writer) error {
+		for {
+			if _, err := io.Copy(w, literals[i]); err != nil {
+				return err
+			}
+			i++
+			if _, err := io.WriteString(w, lines[i]+"\r\n"); err != nil {
+				return err
+			}
+			if i == len(literals) || sync[i] {
+				return nil
+			}
+		}
+	}
+	ret := NewResponse()
+	if !sync[0] {
+		ret.send = next
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.executeLocked(ctx, lines[0], func(w io.Writer, text string) error {
+		if i == len(literals) {
+			return errors.New("Unexpected continuation request: " + text)
+		}
+		return next(w)
+	}, ret)
+}
+
+// quote returns s as a quoted string, or as a Literal if it contains
+// characters a quoted string cannot carry.
+func quote(s string) interface{} {
+	for i := 0; i < len(s); i++ {
+		if b := s[i]; b == '\r' || b == '\n' || b == 0 || b >= 0x80 {
+			return strings.NewReader(s)
+		}
+	}
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
@@ -0,0 +1,70 @@
+package imap
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCommandArguments(t *testing.T) {
+	c := testClient(t, "* PREAUTH ready", func(s *fakeServer) {
+		tag := s.expect(`SEARCH UID 7 LARGER 1024 MODSEQ 99 YOUNGER 3600 SINCE 2-Jan-2006 SUBJECT "a \"b\""`)
+		s.write("* SEARCH 1", tag+" OK done")
+	})
+	date := time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC)
+	_, err := c.Search("UID", UID(7), "LARGER", 1024, "MODSEQ", uint64(99), "YOUNGER", time.Hour, "SINCE", date, "SUBJECT", Quoted(`a "b"`))
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCommandInvalidArgument(t *testing.T) {
+	c := testClient(t, "* PREAUTH ready", func(s *fakeServer) {})
+	for _, arg := range []interface{}{3.5, nil, []string{"ALL"}} {
+		if _, err := c.Search(arg); err == nil {
+			t.Errorf("%#v: no error", arg)
+		}
+	}
+}
+
+func TestCommandInvalidString(t *testing.T) {
+	c := testClient(t, "* PREAUTH ready", func(s *fakeServer) {
+		s.expectNothing()
+	})
+	for _, criteria := range [][]interface{}{
+		{"SUBJECT", "hello world"},
+		{"SUBJECT", "x\r\nA1 DELETE INBOX"},
+		{"FROM", `"bob"`},
+		{`SEEN\`},
+	} {
+		if _, err := c.Search(criteria...); err == nil {
+			t.Errorf("%q: no error", criteria)
+		}
+	}
+	if _, err := c.Sort([]SortKey{SortDate}, "TEXT", "a b"); err == nil {
+		t.Error("Sort: no error")
+	}
+	if err := c.command(context.Background(), "NOOP", "x\r\ny").Error(); err == nil {
+		t.Error("command with CRLF: no error")
+	}
+	for _, flags := range [][]string{{"\\Seen)"}, {"a b"}, {"\\"}, {"x\r\n"}} {
+		if _, err := c.Append("INBOX", flags, time.Time{}, strings.NewReader("")); err == nil {
+			t.Errorf("Append %q: no error", flags)
+		}
+		if _, err := c.Store(NewSeqSet(1), RemoveFlags, true, flags...); err == nil {
+			t.Errorf("Store %q: no error", flags)
+		}
+	}
+	c.Close()
+}
+
+func TestSearchCriteria(t *testing.T) {
+	c := testClient(t, "* PREAUTH ready", func(s *fakeServer) {
+		tag := s.expect(`SEARCH (OR SEEN FLAGGED) UID 1:* KEYWORD $Forwarded SINCE 1-Feb-1994 $`)
+		s.write("* SEARCH", tag+" OK done")
+	})
+	if _, err := c.Search("(OR", "SEEN", "FLAGGED)", "UID", "1:*", "KEYWORD", "$Forwarded", "SINCE", "1-Feb-1994", "$"); err != nil {
+		t.Fatal(err)
+	}
+}
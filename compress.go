@@ -0,0 +1,61 @@
+package imap
+
+import (
+	"bufio"
+	"compress/flate"
+	"context"
+	"errors"
+	"io"
+	"net"
+)
+
+func (c *IMAPClient) Compress() error {
+	return c.CompressContext(context.Background())
+}
+
+// CompressContext issues COMPRESS DEFLATE (RFC 4978), after which
+// everything sent and received is compressed, which pays off for large
+// transfers over slow links. It needs the COMPRESS=DEFLATE extension. With
+// TLS, it should come after StartTLS, which is no longer possible once
+// compression is active.
+func (c *IMAPClient) CompressContext(ctx context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.conn.(*compressConn); ok {
+		return errors.New("Compression already active")
+	}
+	resp := c.executeLocked(ctx, "COMPRESS DEFLATE", nil, NewResponse())
+	if resp.Error() != nil {
+		return resp.Error()
+	}
+	w, err := flate.NewWriter(c.conn, flate.DefaultCompression)
+	if err != nil {
+		return err
+	}
+	// The server compresses whatever follows its response, some of which
+	// c.r may already hold.
+	conn := &compressConn{Conn: c.conn, r: flate.NewReader(c.r), w: w}
+	c.conn = conn
+	c.r = bufio.NewReaderSize(conn, c.r.Size())
+	return nil
+}
+
+// compressConn is a connection whose data is deflated both ways. Each
+// Write is flushed, as a command may wait for the server's answer.
+type compressConn struct {
+	net.Conn
+	r io.ReadCloser
+	w *flate.Writer
+}
+
+func (c *compressConn) Read(p []byte) (int, error) {
+	return c.r.Read(p)
+}
+
+func (c *compressConn) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	if err != nil {
+		return n, err
+	}
+	return n, c.w.Flush()
+}
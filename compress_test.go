@@ -0,0 +1,55 @@
+package imap
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"io"
+	"testing"
+)
+
+// switchWriter lets the server deflate data before it has a connection to
+// send it on.
+type switchWriter struct {
+	w io.Writer
+}
+
+func (w *switchWriter) Write(p []byte) (int, error) {
+	return w.w.Write(p)
+}
+
+func TestCompress(t *testing.T) {
+	c := testClient(t, "* OK [CAPABILITY IMAP4rev1 COMPRESS=DEFLATE] ready", func(s *fakeServer) {
+		tag := s.expect("COMPRESS DEFLATE")
+		// Send compressed data along with the tagged OK, so that the
+		// client has it buffered before it turns compression on.
+		var buf bytes.Buffer
+		out := &switchWriter{w: &buf}
+		w, _ := flate.NewWriter(out, flate.DefaultCompression)
+		w.Write([]byte("* CAPABILITY IMAP4rev1 COMPRESS=DEFLATE X-ZIPPED\r\n"))
+		w.Flush()
+		s.conn.Write(append([]byte(tag+" OK DEFLATE active\r\n"), buf.Bytes()...))
+		out.w = s.conn
+		s.r = bufio.NewReader(flate.NewReader(s.r))
+
+		tag = s.expect("CAPABILITY")
+		w.Write([]byte(tag + " OK done\r\n"))
+		w.Flush()
+	})
+	if err := c.Compress(); err != nil {
+		t.Fatal(err)
+	}
+	caps, err := c.Capability()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !caps["X-ZIPPED"] {
+		t.Errorf("got capabilities %v", caps)
+	}
+	if err := c.Compress(); err == nil {
+		t.Error("second Compress: got no error")
+	}
+	if err := c.StartTLS(nil); err == nil {
+		t.Error("StartTLS after Compress: got no error")
+	}
+}
@@ -0,0 +1,222 @@
+package imap
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"time"
+)
+
+const (
+	DefaultPort    = "143"
+	DefaultTLSPort = "993"
+)
+
+type Dialer struct {
+	// Network is the network to dial: "tcp" (the default), "tcp4", "tcp6"
+	// or "unix". For "unix" the address is a socket path, no default port
+	// is added and Proxy is not used.
+	Network string
+
+	// Timeout bounds connecting, the TLS handshake and reading the
+	// greeting. Zero means no timeout.
+	Timeout time.Duration
+
+	// ReadTimeout, WriteTimeout and CommandTimeout are copied to clients
+	// created by the Dialer.
+	ReadTimeout    time.Duration
+	WriteTimeout   time.Duration
+	CommandTimeout time.Duration
+
+	// BufferSize is the size of the read buffer of created clients. Zero
+	// means DefaultBufferSize.
+	BufferSize int
+
+	// TLSPolicy, if set, is applied to the tls.Config of every TLS
+	// connection the Dialer makes.
+	TLSPolicy *TLSPolicy
+
+	Proxy ProxyDialer
+
+	// NetDialContext, if set, is used instead of net.Dial to open the
+	// connection, both initially and on Reconnect. It is ignored when Proxy
+	// is set.
+	NetDialContext func(ctx context.Context, network, addr string) (net.Conn, error)
+}
+
+func Dial(addr string) (*IMAPClient, error) {
+	var d Dialer
+	return d.Dial(addr)
+}
+
+func DialTLS(addr string, config *tls.Config) (*IMAPClient, error) {
+	var d Dialer
+	return d.DialTLS(addr, config)
+}
+
+func DialStartTLS(addr string, config *tls.Config) (*IMAPClient, error) {
+	var d Dialer
+	return d.DialStartTLS(addr, config)
+}
+
+// DialUnix connects without TLS to an IMAP server listening on the unix
+// socket at path, as local imapd or proxy setups commonly do.
+func DialUnix(path string) (*IMAPClient, error) {
+	d := Dialer{Network: "unix"}
+	return d.Dial(path)
+}
+
+func (d *Dialer) Dial(addr string) (*IMAPClient, error) {
+	return d.DialContext(context.Background(), addr)
+}
+
+func (d *Dialer) DialTLS(addr string, config *tls.Config) (*IMAPClient, error) {
+	return d.DialTLSContext(context.Background(), addr, config)
+}
+
+func (d *Dialer) DialStartTLS(addr string, config *tls.Config) (*IMAPClient, error) {
+	return d.DialStartTLSContext(context.Background(), addr, config)
+}
+
+// DialContext connects in plaintext. If d.TLSPolicy is strict, it upgrades
+// with STARTTLS instead and fails if that is not possible.
+func (d *Dialer) DialContext(ctx context.Context, addr string) (*IMAPClient, error) {
+	if d.TLSPolicy != nil && d.TLSPolicy.Strict {
+		return d.DialStartTLSContext(ctx, addr, nil)
+	}
+	if !d.isUnix() {
+		addr = withPort(addr, DefaultPort)
+	}
+	return d.client(ctx, func(ctx context.Context) (*IMAPClient, error) {
+		conn, err := d.dial(ctx, addr)
+		if err != nil {
+			return nil, err
+		}
+		c, err := newClientPlain(ctx, conn, d.BufferSize)
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+		return c, nil
+	})
+}
+
+func (d *Dialer) DialTLSContext(ctx context.Context, addr string, config *tls.Config) (*IMAPClient, error) {
+	if d.isUnix() {
+		if config == nil || (config.ServerName == "" && !config.InsecureSkipVerify) {
+			return nil, errors.New("TLS over a unix socket needs tls.Config.ServerName")
+		}
+	} else {
+		addr = withPort(addr, DefaultTLSPort)
+		config = tlsConfigFor(addr, config)
+	}
+	config = d.TLSPolicy.Config(config)
+	return d.client(ctx, func(ctx context.Context) (*IMAPClient, error) {
+		conn, err := d.dial(ctx, addr)
+		if err != nil {
+			return nil, err
+		}
+		c, err := newClientTLS(ctx, conn, config, d.BufferSize)
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+		return c, nil
+	})
+}
+
+func (d *Dialer) DialStartTLSContext(ctx context.Context, addr string, config *tls.Config) (*IMAPClient, error) {
+	if d.isUnix() {
+		if config == nil || (config.ServerName == "" && !config.InsecureSkipVerify) {
+			return nil, errors.New("TLS over a unix socket needs tls.Config.ServerName")
+		}
+	} else {
+		addr = withPort(addr, DefaultPort)
+		config = tlsConfigFor(addr, config)
+	}
+	config = d.TLSPolicy.Config(config)
+	return d.client(ctx, func(ctx context.Context) (*IMAPClient, error) {
+		conn, err := d.dial(ctx, addr)
+		if err != nil {
+			return nil, err
+		}
+		c, err := newClientPlain(ctx, conn, d.BufferSize)
+		if err == nil {
+			err = c.StartTLSContext(ctx, config)
+		}
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+		return c, nil
+	})
+}
+
+func (d *Dialer) client(ctx context.Context, connect func(ctx context.Context) (*IMAPClient, error)) (*IMAPClient, error) {
+	redial := func(ctx context.Context) (*IMAPClient, error) {
+		if d.Timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, d.Timeout)
+			defer cancel()
+		}
+		return connect(ctx)
+	}
+	c, err := redial(ctx)
+	if err != nil {
+		return nil, err
+	}
+	c.ReadTimeout = d.ReadTimeout
+	c.WriteTimeout = d.WriteTimeout
+	c.CommandTimeout = d.CommandTimeout
+	c.redial = redial
+	return c, nil
+}
+
+func (d *Dialer) dial(ctx context.Context, addr string) (net.Conn, error) {
+	network := d.network()
+	if d.Proxy != nil && !d.isUnix() {
+		if p, ok := d.Proxy.(ContextDialer); ok {
+			return p.DialContext(ctx, network, addr)
+		}
+		return d.Proxy.Dial(network, addr)
+	}
+	if d.NetDialContext != nil {
+		return d.NetDialContext(ctx, network, addr)
+	}
+	var nd net.Dialer
+	return nd.DialContext(ctx, network, addr)
+}
+
+func (d *Dialer) network() string {
+	if d.Network == "" {
+		return "tcp"
+	}
+	return d.Network
+}
+
+func (d *Dialer) isUnix() bool {
+	return d.network() == "unix"
+}
+
+func withPort(addr, port string) string {
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		return net.JoinHostPort(addr, port)
+	}
+	return addr
+}
+
+func tlsConfigFor(addr string, config *tls.Config) *tls.Config {
+	if config == nil {
+		config = &tls.Config{}
+	}
+	if config.ServerName == "" {
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			host = addr
+		}
+		config = config.Clone()
+		config.ServerName = host
+	}
+	return config
+}
@@ -0,0 +1,65 @@
+package imap
+
+import (
+	"context"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Server is a candidate IMAP server found by LookupServers.
+type Server struct {
+	Host string
+	Port uint16
+	// TLS is true for implicit TLS (imaps). Otherwise the server is
+	// reached in plaintext and is expected to offer STARTTLS.
+	TLS bool
+
+	priority uint16
+}
+
+func (s Server) Addr() string {
+	return net.JoinHostPort(s.Host, strconv.Itoa(int(s.Port)))
+}
+
+// LookupServers resolves the _imaps._tcp and _imap._tcp SRV records
+// (RFC 6186) of domain, which may also be given as an email address. The
+// result is ordered by priority, preferring implicit TLS on ties.
+func LookupServers(domain string) ([]Server, error) {
+	return LookupServersContext(context.Background(), domain)
+}
+
+func LookupServersContext(ctx context.Context, domain string) ([]Server, error) {
+	if i := strings.LastIndex(domain, "@"); i >= 0 {
+		domain = domain[i+1:]
+	}
+	var servers []Server
+	var lastErr error
+	for _, service := range []string{"imaps", "imap"} {
+		_, addrs, err := net.DefaultResolver.LookupSRV(ctx, service, "tcp", domain)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		for _, addr := range addrs {
+			// A target of "." means the service is decidedly not available.
+			if addr.Target == "." {
+				continue
+			}
+			servers = append(servers, Server{
+				Host:     strings.TrimSuffix(addr.Target, "."),
+				Port:     addr.Port,
+				TLS:      service == "imaps",
+				priority: addr.Priority,
+			})
+		}
+	}
+	if len(servers) == 0 && lastErr != nil {
+		return nil, lastErr
+	}
+	sort.SliceStable(servers, func(i, j int) bool {
+		return servers[i].priority < servers[j].priority
+	})
+	return servers, nil
+}
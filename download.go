@@ -0,0 +1,131 @@
+package imap
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+)
+
+const DefaultChunkSize = 1 << 20
+
+// DownloadOptions configures Download.
+type DownloadOptions struct {
+	// ChunkSize is the number of bytes fetched per command. Zero means
+	// DefaultChunkSize.
+	ChunkSize uint32
+	// Retries is how often a download may resume after the connection
+	// broke. Resuming needs Resume and a client created by a Dialer.
+	Retries int
+	// Resume is called after the connection was reopened with Reconnect,
+	// and must authenticate again. Download then selects the mailbox
+	// anew and continues where it stopped, unless its UIDVALIDITY
+	// changed.
+	Resume func(c *IMAPClient) error
+}
+
+func (c *IMAPClient) Download(uid UID, w io.Writer, opts *DownloadOptions) (int64, error) {
+	return c.DownloadContext(context.Background(), uid, w, opts)
+}
+
+// DownloadContext copies the full message with the given UID in the
+// selected mailbox to w without setting \Seen, using partial fetches of
+// opts.ChunkSize bytes so that large messages are neither held in memory
+// nor fetched again from the start if the connection breaks. opts may be
+// nil.
+func (c *IMAPClient) DownloadContext(ctx context.Context, uid UID, w io.Writer, opts *DownloadOptions) (int64, error) {
+	if opts == nil {
+		opts = &DownloadOptions{}
+	}
+	chunk := opts.ChunkSize
+	if chunk == 0 {
+		chunk = DefaultChunkSize
+	}
+	results, err := c.UIDFetchMessagesContext(ctx, NewUIDSet(uid), "RFC822.SIZE")
+	if err != nil {
+		return 0, err
+	}
+	result, ok := results[uint32(uid)]
+	if !ok {
+		return 0, errors.New("No such message " + strconv.FormatUint(uint64(uid), 10))
+	}
+	size := int64(result.Size)
+
+	dst := &downloadWriter{w: w}
+	retries := opts.Retries
+	for {
+		offset := dst.n
+		section := &BodySection{Peek: true, Partial: true, Offset: uint32(offset), Count: chunk}
+		_, err := c.UIDFetchToContext(ctx, uid, section.FetchItem(), dst)
+		if dst.err != nil {
+			return dst.n, dst.err
+		}
+		if err != nil {
+			if retries == 0 || opts.Resume == nil || !isNetError(err) || ctx.Err() != nil {
+				return dst.n, err
+			}
+			retries--
+			if err := c.resumeDownload(ctx, opts.Resume); err != nil {
+				return dst.n, err
+			}
+			continue
+		}
+		// RFC822.SIZE is only a hint: some servers count line endings
+		// differently, so a short chunk is what marks the end.
+		if dst.n-offset < int64(chunk) || (size > 0 && dst.n == size) {
+			return dst.n, nil
+		}
+	}
+}
+
+// resumeDownload reconnects, lets resume authenticate and selects the
+// mailbox that was selected before.
+func (c *IMAPClient) resumeDownload(ctx context.Context, resume func(c *IMAPClient) error) error {
+	mailbox := c.Mailbox()
+	if mailbox == nil {
+		return errors.New("No mailbox selected")
+	}
+	if err := c.ReconnectContext(ctx); err != nil {
+		return err
+	}
+	if err := resume(c); err != nil {
+		return err
+	}
+	var status *MailboxStatus
+	var err error
+	if mailbox.ReadOnly {
+		status, err = c.ExamineContext(ctx, mailbox.Name)
+	} else {
+		status, err = c.SelectContext(ctx, mailbox.Name)
+	}
+	if err != nil {
+		return err
+	}
+	if status.UIDValidity != mailbox.UIDValidity {
+		return errors.New("UIDVALIDITY of " + mailbox.Name + " changed, cannot resume download")
+	}
+	return nil
+}
+
+// downloadWriter counts the bytes written to w and keeps its error apart
+// from those of the connection.
+type downloadWriter struct {
+	w   io.Writer
+	n   int64
+	err error
+}
+
+func (d *downloadWriter) Write(p []byte) (int, error) {
+	n, err := d.w.Write(p)
+	d.n += int64(n)
+	if err != nil {
+		d.err = err
+	}
+	return n, err
+}
+
+func isNetError(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, net.ErrClosed)
+}
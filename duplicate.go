@@ -0,0 +1,54 @@
+package imap
+
+import (
+	"context"
+	"sort"
+	"strings"
+)
+
+func (c *IMAPClient) Duplicates() ([][]UID, error) {
+	return c.DuplicatesContext(context.Background())
+}
+
+// DuplicatesContext finds copies of the same message in the selected
+// mailbox, going by the Message-ID header and size, and fetching only
+// those. It returns the UIDs of each group of copies in ascending order,
+// so all but the first of a group can be deleted. Messages without a
+// Message-ID are never considered duplicates.
+func (c *IMAPClient) DuplicatesContext(ctx context.Context) ([][]UID, error) {
+	type key struct {
+		id   string
+		size uint32
+	}
+	var all SeqSet
+	all.AddRange(1, 0)
+	section := &BodySection{Specifier: SectionHeaderFields, Fields: []string{"Message-ID"}, Peek: true}
+	results, err := c.UIDFetchMessagesContext(ctx, all, "UID", "RFC822.SIZE", section.FetchItem())
+	if err != nil {
+		return nil, err
+	}
+	groups := make(map[key][]UID)
+	for _, result := range results {
+		data, _ := result.Body(section)
+		header, err := parseHeader(data)
+		if err != nil {
+			continue
+		}
+		id := strings.TrimSpace(header.Get("Message-Id"))
+		if id == "" {
+			continue
+		}
+		k := key{id, result.Size}
+		groups[k] = append(groups[k], result.UID)
+	}
+	var dups [][]UID
+	for _, uids := range groups {
+		if len(uids) < 2 {
+			continue
+		}
+		sort.Slice(uids, func(i, j int) bool { return uids[i] < uids[j] })
+		dups = append(dups, uids)
+	}
+	sort.Slice(dups, func(i, j int) bool { return dups[i][0] < dups[j][0] })
+	return dups, nil
+}
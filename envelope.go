@@ -0,0 +1,84 @@
+package imap
+
+import (
+	"errors"
+	"net/mail"
+	"time"
+)
+
+// Envelope is the parsed header of a message, as returned by FETCH
+// ENVELOPE. Subject and display names are decoded from RFC 2047 encoded
+// words where possible.
+type Envelope struct {
+	// Date is zero if the Date header is missing or cannot be parsed.
+	Date      time.Time
+	Subject   string
+	From      []*Address
+	Sender    []*Address
+	ReplyTo   []*Address
+	To        []*Address
+	Cc        []*Address
+	Bcc       []*Address
+	InReplyTo string
+	MessageID string
+}
+
+// Address is an address in an envelope.
+type Address struct {
+	Name    string
+	Mailbox string
+	Host    string
+}
+
+// Address returns the bare address, as in "user@example.com".
+func (a *Address) Address() string {
+	if a.Host == "" {
+		return a.Mailbox
+	}
+	return a.Mailbox + "@" + a.Host
+}
+
+// String formats the address for use in a header.
+func (a *Address) String() string {
+	return (&mail.Address{Name: a.Name, Address: a.Address()}).String()
+}
+
+func parseEnvelope(field interface{}) (*Envelope, error) {
+	fields := asList(field)
+	if len(fields) < 10 {
+		return nil, errors.New("Invalid ENVELOPE")
+	}
+	env := &Envelope{
+		Subject:   DecodeHeader(asString(fields[1])),
+		From:      parseAddressList(fields[2]),
+		Sender:    parseAddressList(fields[3]),
+		ReplyTo:   parseAddressList(fields[4]),
+		To:        parseAddressList(fields[5]),
+		Cc:        parseAddressList(fields[6]),
+		Bcc:       parseAddressList(fields[7]),
+		InReplyTo: asString(fields[8]),
+		MessageID: asString(fields[9]),
+	}
+	if date, err := mail.ParseDate(asString(fields[0])); err == nil {
+		env.Date = date
+	}
+	return env, nil
+}
+
+// parseAddressList reads a list of addresses, leaving out the markers of
+// RFC 5322 groups.
+func parseAddressList(field interface{}) []*Address {
+	var addrs []*Address
+	for _, item := range asList(field) {
+		fields := asList(item)
+		if len(fields) < 4 || fields[3] == nil {
+			continue
+		}
+		addrs = append(addrs, &Address{
+			Name:    DecodeHeader(asString(fields[0])),
+			Mailbox: asString(fields[2]),
+			Host:    asString(fields[3]),
+		})
+	}
+	return addrs
+}
@@ -0,0 +1,55 @@
+package imap
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseEnvelope(t *testing.T) {
+	s := `("Wed, 17 Jul 1996 02:23:25 -0700" "=?utf-8?q?caf=C3=A9?=" ` +
+		`(("Terry Gray" NIL "gray" "cac.washington.edu")) NIL NIL ` +
+		`((NIL NIL "team" NIL)("=?iso-8859-1?q?Andr=E9?=" NIL "andre" "example.com")(NIL NIL NIL NIL)) ` +
+		`NIL NIL "<a@b>" "<B27397-0100000@cac.washington.edu>")`
+	fields, err := parseFields(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	env, err := parseEnvelope(fields[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := time.Date(1996, 7, 17, 9, 23, 25, 0, time.UTC); !env.Date.Equal(want) {
+		t.Errorf("Date = %v, want %v", env.Date, want)
+	}
+	if env.Subject != "café" {
+		t.Errorf("Subject = %q", env.Subject)
+	}
+	if want := []*Address{{Name: "Terry Gray", Mailbox: "gray", Host: "cac.washington.edu"}}; !reflect.DeepEqual(env.From, want) {
+		t.Errorf("From = %+v", env.From)
+	}
+	if want := []*Address{{Name: "André", Mailbox: "andre", Host: "example.com"}}; !reflect.DeepEqual(env.To, want) {
+		t.Errorf("To = %+v, want the group markers left out", env.To)
+	}
+	if env.Sender != nil || env.Cc != nil || env.InReplyTo != "<a@b>" || env.MessageID != "<B27397-0100000@cac.washington.edu>" {
+		t.Errorf("got %+v", env)
+	}
+	if got := env.From[0].Address(); got != "gray@cac.washington.edu" {
+		t.Errorf("Address() = %q", got)
+	}
+	if got := env.From[0].String(); got != `"Terry Gray" <gray@cac.washington.edu>` {
+		t.Errorf("String() = %q", got)
+	}
+}
+
+func TestParseEnvelopeBadDate(t *testing.T) {
+	fields, _ := parseFields(`("yesterday" NIL NIL NIL NIL NIL NIL NIL NIL NIL)`)
+	env, err := parseEnvelope(fields[0])
+	if err != nil || !env.Date.IsZero() {
+		t.Errorf("got %+v, %v", env, err)
+	}
+	fields, _ = parseFields(`(NIL NIL NIL)`)
+	if _, err := parseEnvelope(fields[0]); err == nil {
+		t.Error("short ENVELOPE: got no error")
+	}
+}
@@ -0,0 +1,349 @@
+package imap
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"net/mail"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Fetch macros, which stand for several data items and cannot be
+// combined with other items. Their results fill the fields of FetchResult.
+const (
+	// FetchFast is FLAGS, INTERNALDATE and RFC822.SIZE.
+	FetchFast = "FAST"
+	// FetchAll is FetchFast and ENVELOPE.
+	FetchAll = "ALL"
+	// FetchFull is FetchAll and BODY, the structure without extension
+	// data.
+	FetchFull = "FULL"
+)
+
+// FetchResult is the data the server returned for one message. Common
+// data items are decoded into fields, which are zero if not fetched.
+type FetchResult struct {
+	SeqNum       uint32
+	UID          UID
+	Flags        []string
+	InternalDate time.Time
+	Size         uint32
+	Envelope     *Envelope
+	// BodyStructure is set by the BODYSTRUCTURE item, or BODY without a
+	// section.
+	BodyStructure *BodyStructure
+	// Preview is the server generated plain text snippet of the PREVIEW
+	// item (RFC 8970), empty if the server has none at hand, which it may
+	// report when asked with "PREVIEW (LAZY)".
+	Preview string
+	// ModSeq is the mod-sequence of the message (RFC 7162), returned for
+	// the MODSEQ item and by FetchChangedSince.
+	ModSeq uint64
+
+	// Items maps the upper cased name of each data item, such as "FLAGS"
+	// or "BODY[HEADER]", to its value as parsed by the response parser:
+	// a string, nil or a []interface{} list. It also holds the items
+	// decoded into fields, and those of extensions this package does not
+	// know.
+	Items map[string]interface{}
+}
+
+func (result *FetchResult) parse(items []interface{}) error {
+	for i := 0; i+1 < len(items); i += 2 {
+		name := strings.ToUpper(asString(items[i]))
+		value := items[i+1]
+		result.Items[name] = value
+		switch name {
+		case "UID":
+			uid, _ := asNumber(value)
+			result.UID = UID(uid)
+		case "FLAGS":
+			result.Flags = flagList([]interface{}{value})
+		case "INTERNALDATE":
+			if date, err := time.Parse(DateTimeLayout, asString(value)); err == nil {
+				result.InternalDate = date
+			}
+		case "RFC822.SIZE":
+			result.Size, _ = asNumber(value)
+		case "ENVELOPE":
+			env, err := parseEnvelope(value)
+			if err != nil {
+				return err
+			}
+			result.Envelope = env
+		case "MODSEQ":
+			if list := asList(value); len(list) > 0 {
+				result.ModSeq, _ = asNumber64(list[0])
+			}
+		case "PREVIEW":
+			result.Preview = asString(value)
+		case "BODYSTRUCTURE", "BODY":
+			bs, err := parseBodyStructure(value)
+			if err != nil {
+				return err
+			}
+			result.BodyStructure = bs
+		}
+	}
+	return nil
+}
+
+func (c *IMAPClient) FetchMessages(set SeqSet, items ...string) (map[uint32]*FetchResult, error) {
+	return c.FetchMessagesContext(context.Background(), set, items...)
+}
+
+// FetchMessagesContext fetches the data items, such as "FLAGS" and
+// "RFC822.SIZE", or the single macro FetchFast, FetchAll or FetchFull, of
+// all messages in set with a single command. The result is keyed by
+// sequence number.
+func (c *IMAPClient) FetchMessagesContext(ctx context.Context, set SeqSet, items ...string) (map[uint32]*FetchResult, error) {
+	return c.fetchMessages(ctx, "FETCH", set, items)
+}
+
+// UIDFetchMessages is like FetchMessages but takes UIDs, and the result
+// is keyed by UID.
+func (c *IMAPClient) UIDFetchMessages(set SeqSet, items ...string) (map[uint32]*FetchResult, error) {
+	return c.UIDFetchMessagesContext(context.Background(), set, items...)
+}
+
+func (c *IMAPClient) UIDFetchMessagesContext(ctx context.Context, set SeqSet, items ...string) (map[uint32]*FetchResult, error) {
+	return c.fetchMessages(ctx, "UID FETCH", set, items)
+}
+
+func (c *IMAPClient) FetchChangedSince(set SeqSet, modSeq uint64, items ...string) (map[uint32]*FetchResult, error) {
+	return c.FetchChangedSinceContext(context.Background(), set, modSeq, items...)
+}
+
+// FetchChangedSinceContext is like FetchMessagesContext but only returns
+// the messages whose mod-sequence is greater than modSeq, such as the
+// HighestModSeq of the mailbox when last synchronized, along with their
+// ModSeq. It needs the CONDSTORE extension, which it enables for the rest
+// of the session.
+func (c *IMAPClient) FetchChangedSinceContext(ctx context.Context, set SeqSet, modSeq uint64, items ...string) (map[uint32]*FetchResult, error) {
+	return c.fetchMessages(ctx, "FETCH", set, items, "CHANGEDSINCE "+strconv.FormatUint(modSeq, 10))
+}
+
+// UIDFetchChangedSince is like FetchChangedSince but takes UIDs, and the
+// result is keyed by UID.
+func (c *IMAPClient) UIDFetchChangedSince(set SeqSet, modSeq uint64, items ...string) (map[uint32]*FetchResult, error) {
+	return c.UIDFetchChangedSinceContext(context.Background(), set, modSeq, items...)
+}
+
+func (c *IMAPClient) UIDFetchChangedSinceContext(ctx context.Context, set SeqSet, modSeq uint64, items ...string) (map[uint32]*FetchResult, error) {
+	return c.fetchMessages(ctx, "UID FETCH", set, items, "CHANGEDSINCE "+strconv.FormatUint(modSeq, 10))
+}
+
+func (c *IMAPClient) UIDFetchPartial(set SeqSet, first, last int, items ...string) (map[uint32]*FetchResult, error) {
+	return c.UIDFetchPartialContext(context.Background(), set, first, last, items...)
+}
+
+// UIDFetchPartialContext is like UIDFetchMessagesContext but only fetches
+// the messages from the first to the last of those in set, counting from
+// 1 in UID order, or from -1 backwards from the end if both are negative.
+// Paging through set, as in UIDFetchPartial(all, -1, -50, ...) for the
+// newest 50 messages, needs no search for the UIDs of each page. It needs
+// the PARTIAL extension (RFC 9394).
+func (c *IMAPClient) UIDFetchPartialContext(ctx context.Context, set SeqSet, first, last int, items ...string) (map[uint32]*FetchResult, error) {
+	return c.fetchMessages(ctx, "UID FETCH", set, items, partialRange(first, last))
+}
+
+// partialRange returns the PARTIAL modifier for a range of results.
+func partialRange(first, last int) string {
+	return "PARTIAL " + strconv.Itoa(first) + ":" + strconv.Itoa(last)
+}
+
+// fetchMessages fetches items of the messages in set, adding the given
+// modifiers, such as "CHANGEDSINCE 42".
+func (c *IMAPClient) fetchMessages(ctx context.Context, cmd string, set SeqSet, items []string, modifiers ...string) (map[uint32]*FetchResult, error) {
+	arg := strings.Join(items, " ")
+	if len(items) > 1 {
+		for _, item := range items {
+			switch strings.ToUpper(item) {
+			case FetchFast, FetchAll, FetchFull:
+				return nil, errors.New("Fetch macro " + item + " cannot be combined with other items")
+			}
+		}
+		arg = "(" + arg + ")"
+	}
+	args := []interface{}{cmd, set, arg}
+	if len(modifiers) > 0 {
+		args = append(args, "("+strings.Join(modifiers, " ")+")")
+	}
+	resp := c.command(ctx, args...)
+	if resp.Error() != nil {
+		return nil, resp.Error()
+	}
+	results := make(map[uint32]*FetchResult)
+	for _, reply := range resp.Replys() {
+		seq, list, ok := fetchItems(reply)
+		if !ok {
+			continue
+		}
+		key := seq
+		if cmd == "UID FETCH" {
+			if key, ok = asNumber(fetchItem(list, "UID")); !ok {
+				continue
+			}
+		}
+		// Leave out unsolicited FETCH responses, such as flag changes
+		// made by other clients, for messages not asked for.
+		if !set.saved && !set.Contains(key) {
+			continue
+		}
+		result := results[key]
+		if result == nil {
+			result = &FetchResult{SeqNum: seq, Items: make(map[string]interface{})}
+			results[key] = result
+		}
+		if err := result.parse(list); err != nil {
+			return nil, err
+		}
+	}
+	return results, nil
+}
+
+func (c *IMAPClient) FetchHeaders(set SeqSet, fields ...string) (map[uint32]mail.Header, error) {
+	return c.FetchHeadersContext(context.Background(), set, fields...)
+}
+
+// FetchHeadersContext fetches only the named header fields, such as
+// "From", "Subject" and "Date", of the messages in set, without setting
+// \Seen. The result is keyed by sequence number.
+func (c *IMAPClient) FetchHeadersContext(ctx context.Context, set SeqSet, fields ...string) (map[uint32]mail.Header, error) {
+	return c.fetchHeaders(ctx, "FETCH", set, fields)
+}
+
+// UIDFetchHeaders is like FetchHeaders but takes UIDs, and the result is
+// keyed by UID.
+func (c *IMAPClient) UIDFetchHeaders(set SeqSet, fields ...string) (map[uint32]mail.Header, error) {
+	return c.UIDFetchHeadersContext(context.Background(), set, fields...)
+}
+
+func (c *IMAPClient) UIDFetchHeadersContext(ctx context.Context, set SeqSet, fields ...string) (map[uint32]mail.Header, error) {
+	return c.fetchHeaders(ctx, "UID FETCH", set, fields)
+}
+
+func (c *IMAPClient) fetchHeaders(ctx context.Context, cmd string, set SeqSet, fields []string) (map[uint32]mail.Header, error) {
+	section := &BodySection{Specifier: SectionHeaderFields, Fields: fields, Peek: true}
+	results, err := c.fetchMessages(ctx, cmd, set, []string{section.FetchItem()})
+	if err != nil {
+		return nil, err
+	}
+	headers := make(map[uint32]mail.Header, len(results))
+	for id, result := range results {
+		data, ok := result.Body(section)
+		if !ok {
+			continue
+		}
+		header, err := parseHeader(data)
+		if err != nil {
+			return nil, err
+		}
+		headers[id] = header
+	}
+	return headers, nil
+}
+
+func parseHeader(data string) (mail.Header, error) {
+	header, err := textproto.NewReader(bufio.NewReader(strings.NewReader(data))).ReadMIMEHeader()
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	return mail.Header(header), nil
+}
+
+func (c *IMAPClient) FetchTo(seq uint32, item string, w io.Writer) (int64, error) {
+	return c.FetchToContext(context.Background(), seq, item, w)
+}
+
+// FetchToContext fetches a single data item of a message, such as
+// "BODY.PEEK[]" or "BODY[2]", and copies it to w as it arrives instead of
+// holding it in memory. It returns the number of bytes written.
+func (c *IMAPClient) FetchToContext(ctx context.Context, seq uint32, item string, w io.Writer) (int64, error) {
+	return c.fetchTo(ctx, "FETCH", seq, item, w)
+}
+
+// UIDFetchTo is like FetchTo but takes a UID.
+func (c *IMAPClient) UIDFetchTo(uid UID, item string, w io.Writer) (int64, error) {
+	return c.UIDFetchToContext(context.Background(), uid, item, w)
+}
+
+func (c *IMAPClient) UIDFetchToContext(ctx context.Context, uid UID, item string, w io.Writer) (int64, error) {
+	return c.fetchTo(ctx, "UID FETCH", uint32(uid), item, w)
+}
+
+func (c *IMAPClient) fetchTo(ctx context.Context, cmd string, id uint32, item string, w io.Writer) (int64, error) {
+	num := strconv.FormatUint(uint64(id), 10)
+	name := responseItemName(item)
+	resp := NewResponse()
+	resp.stream = w
+	resp.streamIf = func(prefix string) bool {
+		// Only stream the item of the message asked for, not those of
+		// unsolicited FETCH responses; a UID after the literal comes too
+		// late to tell, leaving the literal to the check below.
+		upper := strings.ToUpper(strings.TrimRight(prefix, " "))
+		if !strings.HasSuffix(upper, name) {
+			return false
+		}
+		if i := len(upper) - len(name) - 1; i < 0 || (upper[i] != ' ' && upper[i] != '(') {
+			return false
+		}
+		fields := strings.Fields(strings.Replace(upper[:len(upper)-len(name)], "(", " ", -1))
+		if len(fields) < 2 || fields[1] != "FETCH" {
+			return false
+		}
+		if cmd == "FETCH" {
+			return fields[0] == num
+		}
+		for i := 2; i+1 < len(fields); i++ {
+			if fields[i] == "UID" && fields[i+1] == num {
+				return true
+			}
+		}
+		return false
+	}
+	c.mu.Lock()
+	c.executeLocked(ctx, cmd+" "+num+" "+item, nil, resp)
+	c.mu.Unlock()
+	if resp.Error() != nil {
+		return resp.streamed, resp.Error()
+	}
+	if resp.streamErr != nil || resp.streamed > 0 {
+		return resp.streamed, resp.streamErr
+	}
+	// Small values may come as a quoted string rather than a literal, and
+	// a literal before the UID is kept in the reply.
+	for _, reply := range resp.Replys() {
+		seq, items, ok := fetchItems(reply)
+		if !ok {
+			continue
+		}
+		if cmd == "FETCH" && seq != id {
+			continue
+		}
+		if uid, _ := asNumber(fetchItem(items, "UID")); cmd != "FETCH" && uid != id {
+			continue
+		}
+		if value, ok := fetchItem(items, name).(string); ok {
+			n, err := io.WriteString(w, value)
+			return int64(n), err
+		}
+	}
+	return 0, errors.New("No such message " + num)
+}
+
+// responseItemName returns the name the server uses for a fetch item in
+// its response, which drops .PEEK and the length of a partial range.
+func responseItemName(item string) string {
+	name := strings.Replace(strings.ToUpper(item), ".PEEK[", "[", 1)
+	if i := strings.LastIndexByte(name, '<'); i >= 0 && strings.HasSuffix(name, ">") {
+		if dot := strings.IndexByte(name[i:], '.'); dot >= 0 {
+			name = name[:i+dot] + ">"
+		}
+	}
+	return name
+}
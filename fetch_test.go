@@ -0,0 +1,59 @@
+package imap
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestFetchToSkipsUnsolicited(t *testing.T) {
+	c := testClient(t, "* PREAUTH ready", func(s *fakeServer) {
+		tag := s.expect("FETCH 7 BODY.PEEK[]")
+		s.write(
+			"* 3 FETCH (BODY[] {5}", "other FLAGS (\\Seen))",
+			"* 7 FETCH (FLAGS () BODY[HEADER] {4}", "head BODY[] {5}", "hello)",
+			tag+" OK done",
+		)
+	})
+	var buf bytes.Buffer
+	n, err := c.FetchTo(7, "BODY.PEEK[]", &buf)
+	if err != nil || n != 5 || buf.String() != "hello" {
+		t.Errorf("got %d, %q, %v", n, buf.String(), err)
+	}
+}
+
+func TestUIDFetchToLateUID(t *testing.T) {
+	c := testClient(t, "* PREAUTH ready", func(s *fakeServer) {
+		tag := s.expect("UID FETCH 42 BODY.PEEK[1]")
+		s.write(
+			"* 3 FETCH (UID 41 BODY[1] {5}", "other)",
+			"* 4 FETCH (BODY[1] {5}", "hello UID 42)",
+			tag+" OK done",
+		)
+	})
+	var buf bytes.Buffer
+	n, err := c.UIDFetchTo(42, "BODY.PEEK[1]", &buf)
+	if err != nil || n != 5 || buf.String() != "hello" {
+		t.Errorf("got %d, %q, %v", n, buf.String(), err)
+	}
+}
+
+func TestFetchMessagesSkipsUnsolicited(t *testing.T) {
+	c := testClient(t, "* PREAUTH ready", func(s *fakeServer) {
+		tag := s.expect("UID FETCH 10:11 FLAGS")
+		s.write(
+			"* 1 FETCH (UID 10 FLAGS (\\Seen))",
+			"* 9 FETCH (UID 30 FLAGS (\\Deleted))",
+			"* 2 FETCH (UID 11 FLAGS ())",
+			"* 5 FETCH (FLAGS (\\Flagged))",
+			tag+" OK done",
+		)
+	})
+	set, _ := ParseSeqSet("10:11")
+	results, err := c.UIDFetchMessages(set, "FLAGS")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 || results[10] == nil || results[11] == nil {
+		t.Errorf("got %v", results)
+	}
+}
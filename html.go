@@ -0,0 +1,120 @@
+package imap
+
+import (
+	"html"
+	"regexp"
+	"strings"
+)
+
+var (
+	htmlToken = regexp.MustCompile(`(?s)<!--.*?-->|<(/?)([a-zA-Z][a-zA-Z0-9]*)((?:[^>"']|"[^"]*"|'[^']*')*)>`)
+	htmlAttr  = regexp.MustCompile(`(?i)\b(href|alt)\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s>]+))`)
+	htmlSpace = regexp.MustCompile(`\s+`)
+	blankRuns = regexp.MustCompile(`\n{3,}`)
+)
+
+// HTMLToText converts an HTML body to readable plain text for messages
+// that have no text/plain part. Block elements start new lines, list items
+// are bulleted, images are replaced by their alt text and links keep
+// their target in angle brackets after the link text. Scripts, styles and
+// comments are dropped.
+func HTMLToText(s string) string {
+	var b strings.Builder
+	var href, linkText string
+	pre := 0
+	text := func(t string) {
+		t = html.UnescapeString(t)
+		if pre == 0 {
+			t = htmlSpace.ReplaceAllString(t, " ")
+			if strings.HasSuffix(b.String(), "\n") || b.Len() == 0 {
+				t = strings.TrimLeft(t, " ")
+			}
+		}
+		b.WriteString(t)
+		if href != "" {
+			linkText += t
+		}
+	}
+	newline := func() {
+		if b.Len() > 0 && !strings.HasSuffix(b.String(), "\n") {
+			b.WriteString("\n")
+		}
+	}
+	for len(s) > 0 {
+		m := htmlToken.FindStringSubmatchIndex(s)
+		if m == nil {
+			text(s)
+			break
+		}
+		text(s[:m[0]])
+		token := s[m[0]:m[1]]
+		s = s[m[1]:]
+		if m[4] < 0 {
+			continue // comment
+		}
+		closing := m[3] > m[2]
+		name := strings.ToLower(token[m[4]-m[0] : m[5]-m[0]])
+		attrs := attributes(token[m[6]-m[0] : m[7]-m[0]])
+		switch name {
+		case "head", "script", "style", "title":
+			if !closing {
+				if end := strings.Index(strings.ToLower(s), "</"+name); end >= 0 {
+					s = s[end:]
+				} else {
+					s = ""
+				}
+			}
+		case "br":
+			b.WriteString("\n")
+		case "p", "div", "h1", "h2", "h3", "h4", "h5", "h6", "table", "ul", "ol", "blockquote", "hr", "dl", "dt", "dd", "section", "article", "header", "footer":
+			newline()
+			if name == "p" && closing || name == "hr" {
+				b.WriteString("\n")
+			}
+		case "tr":
+			newline()
+		case "td", "th":
+			if closing {
+				b.WriteString(" ")
+			}
+		case "li":
+			newline()
+			if !closing {
+				b.WriteString("- ")
+			}
+		case "pre":
+			newline()
+			if closing {
+				pre--
+			} else {
+				pre++
+			}
+		case "img":
+			text(attrs["alt"])
+		case "a":
+			if !closing {
+				href, linkText = attrs["href"], ""
+			} else if href != "" {
+				if target := strings.TrimPrefix(href, "mailto:"); strings.TrimSpace(linkText) != target && !strings.HasPrefix(href, "#") {
+					b.WriteString(" <" + href + ">")
+				}
+				href = ""
+			}
+		}
+	}
+	lines := strings.Split(b.String(), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, " \t")
+	}
+	return strings.TrimSpace(blankRuns.ReplaceAllString(strings.Join(lines, "\n"), "\n\n"))
+}
+
+// attributes returns the href and alt attributes in the attribute text of
+// a tag, unescaped.
+func attributes(s string) map[string]string {
+	attrs := make(map[string]string)
+	for _, m := range htmlAttr.FindAllStringSubmatch(s, -1) {
+		attrs[strings.ToLower(m[1])] = html.UnescapeString(m[2] + m[3] + m[4])
+	}
+	return attrs
+}
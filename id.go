@@ -0,0 +1,80 @@
+package imap
+
+import (
+	"context"
+	"sort"
+	"strings"
+)
+
+// Common ID field names (RFC 2971 section 3.3).
+const (
+	IDName       = "name"
+	IDVersion    = "version"
+	IDOS         = "os"
+	IDOSVersion  = "os-version"
+	IDVendor     = "vendor"
+	IDSupportURL = "support-url"
+)
+
+func (c *IMAPClient) ID(client map[string]string) (map[string]string, error) {
+	return c.IDContext(context.Background(), client)
+}
+
+// IDContext sends the identification of the client, which may be nil, and
+// returns the server's (RFC 2971). Some servers refuse to select mailboxes
+// until a client has identified itself.
+func (c *IMAPClient) IDContext(ctx context.Context, client map[string]string) (map[string]string, error) {
+	args := []interface{}{"ID"}
+	if len(client) == 0 {
+		args = append(args, "NIL")
+	} else {
+		keys := make([]string, 0, len(client))
+		for k := range client {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		var fields []string
+		for _, k := range keys {
+			fields = append(fields, quoteID(k), quoteID(client[k]))
+		}
+		args = append(args, "("+strings.Join(fields, " ")+")")
+	}
+	resp := c.command(ctx, args...)
+	if resp.Error() != nil {
+		return nil, resp.Error()
+	}
+	for _, reply := range resp.Replys() {
+		args, ok := replyArgs(reply, "ID")
+		if !ok {
+			continue
+		}
+		fields, err := parseFields(args)
+		if err != nil || len(fields) < 1 {
+			continue
+		}
+		list := asList(fields[0])
+		if list == nil {
+			return nil, nil
+		}
+		server := make(map[string]string)
+		for i := 0; i+1 < len(list); i += 2 {
+			if list[i+1] != nil {
+				server[asString(list[i])] = asString(list[i+1])
+			}
+		}
+		return server, nil
+	}
+	return nil, nil
+}
+
+// quoteID quotes s for ID, which is always sent as quoted strings: bytes a
+// quoted string cannot carry are replaced with '?'.
+func quoteID(s string) string {
+	s = strings.Map(func(r rune) rune {
+		if r == '\r' || r == '\n' || r == 0 || r >= 0x80 {
+			return '?'
+		}
+		return r
+	}, s)
+	return quote(s).(string)
+}
@@ -0,0 +1,242 @@
+package imap
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Update is an untagged response the server sends on its own, as it does
+// during IDLE to report changes to the selected mailbox.
+type Update struct {
+	// Type is the upper cased name of the response, as in "EXISTS",
+	// "EXPUNGE", "FETCH", "VANISHED" or "BYE".
+	Type string
+	// Num is the number of messages of EXISTS and RECENT, and the sequence
+	// number of the message of EXPUNGE and FETCH.
+	Num uint32
+	// Fetch holds the data of a FETCH response, typically new FLAGS.
+	Fetch *FetchResult
+	// UIDs are the UIDs of the messages of a VANISHED response, which
+	// replaces EXPUNGE once QRESYNC is enabled. Earlier is set for
+	// VANISHED (EARLIER), which reports messages expunged before rather
+	// than just now.
+	UIDs    SeqSet
+	Earlier bool
+	// Search holds the changes of an ESEARCH response to a result kept up
+	// to date with SearchUpdate.
+	Search *SearchData
+	// Text is the whole response without the leading "* ".
+	Text string
+}
+
+func parseUpdate(r reply) *Update {
+	u := &Update{Text: r.Origin()}
+	fields := strings.Fields(u.Text)
+	if len(fields) == 0 {
+		return u
+	}
+	n, ok := asNumber(fields[0])
+	if !ok || len(fields) < 2 {
+		u.Type = strings.ToUpper(fields[0])
+		switch u.Type {
+		case "VANISHED":
+			u.UIDs, u.Earlier, _ = parseVanished(u.Text)
+		case "ESEARCH":
+			if fields, err := parseFields(u.Text); err == nil {
+				data := &SearchData{}
+				if data.parse(fields[1:]) == nil {
+					u.Search = data
+				}
+			}
+		}
+		return u
+	}
+	u.Type, u.Num = strings.ToUpper(fields[1]), n
+	if u.Type == "FETCH" {
+		if _, items, ok := fetchItems(r); ok {
+			result := &FetchResult{SeqNum: n, Items: make(map[string]interface{})}
+			if result.parse(items) == nil {
+				u.Fetch = result
+			}
+		}
+	}
+	return u
+}
+
+// DefaultIdleInterval is how long IdleContext idles before reissuing IDLE
+// if IdleInterval is not set, safely below the 29 minutes after which
+// servers may drop an idle client.
+const DefaultIdleInterval = 25 * time.Minute
+
+// Idle is like IdleContext but idles until stop is closed, and then
+// returns nil.
+func (c *IMAPClient) Idle(stop <-chan struct{}, fn func(u *Update)) error {
+	ctx, cancel := stopContext(stop)
+	defer cancel()
+	if err := c.IdleContext(ctx, fn); err != context.Canceled {
+		return err
+	}
+	return nil
+}
+
+// IdleContext issues IDLE (RFC 2177) and calls fn with each update the
+// server sends until ctx is done, when it ends IDLE with DONE and returns
+// ctx.Err() once the server confirms. IDLE is ended and issued again every
+// IdleInterval, letting commands from other goroutines, which otherwise
+// wait, run in between. fn runs on the goroutine reading the connection,
+// so it should not block for long, and it must not call methods of c,
+// which wait for IDLE to end; to wait for new mail, it can cancel ctx when
+// it sees EXISTS.
+func (c *IMAPClient) IdleContext(ctx context.Context, fn func(u *Update)) error {
+	interval := c.IdleInterval
+	if interval <= 0 {
+		interval = DefaultIdleInterval
+	}
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := c.idle(ctx, interval, fn); err != nil {
+			return err
+		}
+	}
+}
+
+// idle runs one IDLE command until ctx is done or interval has passed.
+// Since ending IDLE with DONE leaves the session intact, a done ctx is
+// not treated like in other commands; I/O uses a background context.
+func (c *IMAPClient) idle(ctx context.Context, interval time.Duration, fn func(u *Update)) error {
+	bg := context.Background()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.count++
+	if err := c.write(bg, []byte(fmt.Sprintf("a%03d IDLE\r\n", c.count))); err != nil {
+		return err
+	}
+
+	// The server may stay silent for as long as it likes while idling, so
+	// ReadTimeout only applies once DONE is sent.
+	if err := c.setDeadline(bg, 0, c.conn.SetReadDeadline); err != nil {
+		return err
+	}
+	idling := make(chan struct{})
+	finished := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		select {
+		case <-idling:
+		case <-finished:
+			return
+		}
+		timer := time.NewTimer(interval)
+		defer timer.Stop()
+		select {
+		case <-ctx.Done():
+		case <-timer.C:
+		case <-finished:
+			return
+		}
+		if err := c.write(bg, []byte("DONE\r\n")); err != nil {
+			c.conn.Close()
+			return
+		}
+		c.setDeadline(bg, c.ReadTimeout, c.conn.SetReadDeadline)
+	}()
+	defer wg.Wait()
+	defer close(finished)
+
+	resp := NewResponse()
+	for n := 0; ; {
+		if _, err := c.r.Peek(1); err != nil {
+			return err
+		}
+		buf, _ := c.r.Peek(c.r.Buffered())
+		m, _, err := resp.feed(buf)
+		c.r.Discard(m)
+		if err != nil {
+			c.conn.Close()
+			return err
+		}
+		for ; n < len(resp.replys); n++ {
+			fn(parseUpdate(resp.replys[n]))
+		}
+		if resp.feedStatus == feedFinished {
+			break
+		}
+		if _, ok := resp.Continuation(); ok {
+			select {
+			case <-idling:
+			default:
+				close(idling)
+			}
+		}
+	}
+	c.update("IDLE", resp)
+	c.lastUsed = time.Now()
+	return resp.Error()
+}
+
+// DefaultPollInterval is how often WatchContext polls servers without IDLE
+// if PollInterval is not set.
+const DefaultPollInterval = time.Minute
+
+// Watch is like WatchContext but watches until stop is closed, and then
+// returns nil.
+func (c *IMAPClient) Watch(stop <-chan struct{}, fn func(u *Update)) error {
+	ctx, cancel := stopContext(stop)
+	defer cancel()
+	if err := c.WatchContext(ctx, fn); err != context.Canceled {
+		return err
+	}
+	return nil
+}
+
+// WatchContext calls fn with the updates the server reports for the
+// selected mailbox until ctx is done, and then returns ctx.Err(). It idles
+// with IdleContext if the server supports IDLE, and otherwise issues NOOP
+// every PollInterval, which servers answer with the same updates.
+func (c *IMAPClient) WatchContext(ctx context.Context, fn func(u *Update)) error {
+	if c.Supports("IDLE") {
+		return c.IdleContext(ctx, fn)
+	}
+	interval := c.PollInterval
+	if interval <= 0 {
+		interval = DefaultPollInterval
+	}
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-t.C:
+		}
+		// NOOP runs to completion even if ctx is done meanwhile, which
+		// would otherwise close the connection.
+		resp := c.DoContext(context.Background(), "NOOP")
+		if resp.Error() != nil {
+			return resp.Error()
+		}
+		for _, reply := range resp.Replys() {
+			fn(parseUpdate(reply))
+		}
+	}
+}
+
+// stopContext returns a context that is canceled when stop is closed.
+func stopContext(stop <-chan struct{}) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		select {
+		case <-stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, cancel
+}
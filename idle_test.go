@@ -0,0 +1,93 @@
+package imap
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestParseUpdate(t *testing.T) {
+	for _, tt := range []struct {
+		line string
+		typ  string
+		num  uint32
+	}{
+		{"* 23 EXISTS", "EXISTS", 23},
+		{"* 5 expunge", "EXPUNGE", 5},
+		{"* 1 RECENT", "RECENT", 1},
+		{"* BYE shutting down", "BYE", 0},
+		{"* FLAGS (\\Seen \\Deleted)", "FLAGS", 0},
+	} {
+		resp := NewResponse()
+		if _, _, err := resp.feed([]byte(tt.line + "\r\n")); err != nil || len(resp.replys) != 1 {
+			t.Fatalf("%q: %v", tt.line, err)
+		}
+		u := parseUpdate(resp.replys[0])
+		if u.Type != tt.typ || u.Num != tt.num || u.Text != tt.line[2:] {
+			t.Errorf("%q: got %+v", tt.line, u)
+		}
+	}
+}
+
+func TestIdle(t *testing.T) {
+	c := testClient(t, "* PREAUTH [CAPABILITY IMAP4rev1 IDLE] ready", func(s *fakeServer) {
+		tag := s.expect("IDLE")
+		s.write("+ idling", "* 4 EXISTS", `* 2 FETCH (FLAGS (\Seen))`, "* VANISHED 7:9")
+		if line := s.readLine(); line != "DONE" {
+			t.Errorf("got %q, want DONE", line)
+		}
+		s.write(tag + " OK IDLE terminated")
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var updates []*Update
+	err := c.IdleContext(ctx, func(u *Update) {
+		updates = append(updates, u)
+		if u.Type == "VANISHED" {
+			cancel()
+		}
+	})
+	if err != context.Canceled {
+		t.Fatalf("got %v, want context.Canceled", err)
+	}
+	if len(updates) != 3 {
+		t.Fatalf("got %d updates", len(updates))
+	}
+	if u := updates[0]; u.Type != "EXISTS" || u.Num != 4 {
+		t.Errorf("got %+v", u)
+	}
+	if u := updates[1]; u.Type != "FETCH" || u.Num != 2 || u.Fetch == nil || len(u.Fetch.Flags) != 1 {
+		t.Errorf("got %+v", u)
+	}
+	if u := updates[2]; u.UIDs.String() != "7:9" || u.Earlier {
+		t.Errorf("got %+v", u)
+	}
+}
+
+func TestIdleReissue(t *testing.T) {
+	c := testClient(t, "* PREAUTH [CAPABILITY IMAP4rev1 IDLE] ready", func(s *fakeServer) {
+		tag := s.expect("IDLE")
+		s.write("+ idling")
+		if line := s.readLine(); line != "DONE" {
+			t.Errorf("got %q, want DONE", line)
+		}
+		s.write(tag + " OK IDLE terminated")
+		tag = s.expect("IDLE")
+		s.write("+ idling", "* 1 EXISTS")
+		if line := s.readLine(); line != "DONE" {
+			t.Errorf("got %q, want DONE", line)
+		}
+		s.write(tag + " OK IDLE terminated")
+	})
+	c.IdleInterval = 10 * time.Millisecond
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	err := c.IdleContext(ctx, func(u *Update) {
+		if u.Type == "EXISTS" {
+			cancel()
+		}
+	})
+	if err != context.Canceled {
+		t.Errorf("got %v, want context.Canceled", err)
+	}
+}
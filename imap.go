@@ -3,14 +3,29 @@ package imap
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"crypto/tls"
 	"errors"
 	"fmt"
+	"io"
 	"net"
 	"net/mail"
-	"net/textproto"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
+)
+
+const DefaultBufferSize = 64 * 1024
+
+// State is the connection state of an IMAP session (RFC 3501 section 3).
+type State int
+
+const (
+	NotAuthenticatedState State = iota
+	AuthenticatedState
+	SelectedState
+	LogoutState
 )
 
 const (
@@ -18,114 +33,823 @@ const (
 	RFC822Text   = "rfc822.text"
 	Seen         = "\\Seen"
 	Deleted      = "\\Deleted"
-	Inbox        = "INBOX"
+	Answered     = "\\Answered"
+	Flagged      = "\\Flagged"
+	Draft        = "\\Draft"
+	// Recent is set by the server and cannot be stored.
+	Recent = "\\Recent"
+	// AnyKeyword in PermanentFlags means new keywords can be stored.
+	AnyKeyword = "\\*"
+	Inbox      = "INBOX"
 )
 
 type IMAPClient struct {
-	conn  *tls.Conn
+	// ReadTimeout and WriteTimeout bound each read from and write to the
+	// connection. CommandTimeout bounds a whole command including its
+	// response. Zero means no timeout.
+	ReadTimeout    time.Duration
+	WriteTimeout   time.Duration
+	CommandTimeout time.Duration
+	// IdleInterval is how often IdleContext reissues IDLE, by default
+	// DefaultIdleInterval.
+	IdleInterval time.Duration
+	// PollInterval is how often WatchContext polls servers without IDLE,
+	// by default DefaultPollInterval.
+	PollInterval time.Duration
+
+	// AllowInsecureLogin makes Login send the password even when the
+	// server advertises LOGINDISABLED on a connection without TLS.
+	AllowInsecureLogin bool
+
+	conn  net.Conn
+	r     *bufio.Reader
 	count int
-	buf   []byte
+
+	greeting  Greeting
+	state     State
+	mailbox   *MailboxStatus
+	caps      Capabilities
+	enabled   Capabilities
+	delimiter *string
+
+	// mu serializes commands, which the keepalive issues from another
+	// goroutine. lastUsed is when the last command finished.
+	mu       sync.Mutex
+	lastUsed time.Time
+
+	deadlineMu sync.Mutex
+	redial     func(ctx context.Context) (*IMAPClient, error)
 }
 
 func NewClient(conn net.Conn, hostname string) (*IMAPClient, error) {
 	config := tls.Config{
 		ServerName: hostname,
 	}
-	c := tls.Client(conn, &config)
-	buf := make([]byte, 1024)
-REPLY:
-	for {
-		n, err := c.Read(buf)
-		if err != nil {
-			return nil, err
-		}
-		for _, i := range buf[:n] {
-			if i == byte('\n') {
-				break REPLY
+	return NewClientTLS(conn, &config)
+}
+
+func NewClientTLS(conn net.Conn, config *tls.Config) (*IMAPClient, error) {
+	return newClientTLS(context.Background(), conn, config, DefaultBufferSize)
+}
+
+func NewClientPlain(conn net.Conn) (*IMAPClient, error) {
+	return newClientPlain(context.Background(), conn, DefaultBufferSize)
+}
+
+func NewClientStartTLS(conn net.Conn, hostname string) (*IMAPClient, error) {
+	c, err := NewClientPlain(conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	config := tls.Config{
+		ServerName: hostname,
+	}
+	if err := c.StartTLS(&config); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+func newClientTLS(ctx context.Context, conn net.Conn, config *tls.Config, size int) (*IMAPClient, error) {
+	c := tls.Client(conn, config)
+	stop := watchContext(ctx, conn, nil)
+	err := c.Handshake()
+	if cerr := stop(); cerr != nil {
+		err = cerr
+	}
+	if err != nil {
+		return nil, err
+	}
+	return newClientPlain(ctx, c, size)
+}
+
+func newClientPlain(ctx context.Context, conn net.Conn, size int) (*IMAPClient, error) {
+	if size <= 0 {
+		size = DefaultBufferSize
+	}
+	r := bufio.NewReaderSize(conn, size)
+	stop := watchContext(ctx, conn, nil)
+	greeting, err := readGreeting(r)
+	if cerr := stop(); cerr != nil {
+		err = cerr
+	}
+	if err != nil {
+		return nil, err
+	}
+	c := &IMAPClient{
+		conn:     conn,
+		r:        r,
+		greeting: greeting,
+		lastUsed: time.Now(),
+	}
+	if greeting.Status == "PREAUTH" {
+		c.state = AuthenticatedState
+	}
+	if code, args := responseCode(greeting.Text); code == "CAPABILITY" {
+		c.caps = parseCapabilities(strings.Fields(args))
+	}
+	return c, nil
+}
+
+// Greeting is the first response of the server.
+type Greeting struct {
+	// Status is "OK", or "PREAUTH" if the session is already
+	// authenticated.
+	Status string
+	// Text is the rest of the line, including any response code such as
+	// [CAPABILITY ...].
+	Text string
+}
+
+// ByeError is returned when the server greets with BYE, refusing the
+// connection, for instance because too many are open.
+type ByeError struct {
+	Text string
+}
+
+func (e *ByeError) Error() string {
+	return "Server refused the connection: " + e.Text
+}
+
+// StatusError is the error of a command the server answered with NO,
+// because it failed, or BAD, because the server did not accept it.
+type StatusError struct {
+	// Status is "NO" or "BAD".
+	Status string
+	// Text is the rest of the status line, including any response code.
+	Text string
+}
+
+func (e *StatusError) Error() string {
+	if e.Text == "" {
+		return e.Status
+	}
+	return e.Status + " " + e.Text
+}
+
+func readGreeting(r *bufio.Reader) (Greeting, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return Greeting{}, err
+	}
+	line = strings.TrimRight(line, "\r\n")
+	fields := strings.SplitN(line, " ", 3)
+	if len(fields) < 2 || fields[0] != "*" {
+		return Greeting{}, errors.New("Invalid greeting: " + line)
+	}
+	g := Greeting{Status: strings.ToUpper(fields[1])}
+	if len(fields) > 2 {
+		g.Text = fields[2]
+	}
+	switch g.Status {
+	case "OK", "PREAUTH":
+		return g, nil
+	case "BYE":
+		return g, &ByeError{Text: g.Text}
+	}
+	return Greeting{}, errors.New("Invalid greeting: " + line)
+}
+
+// Greeting returns the greeting the server sent when the connection was
+// made.
+func (c *IMAPClient) Greeting() Greeting {
+	return c.greeting
+}
+
+// watchContext interrupts any blocked I/O on conn once ctx is done. The
+// returned function stops watching and reports ctx's error if it fired;
+// in that case the protocol state of conn is unknown.
+//
+// If mu is not nil it is held while the deadline is moved, so that a caller
+// holding it can check ctx before extending the deadline without racing.
+func watchContext(ctx context.Context, conn net.Conn, mu *sync.Mutex) func() error {
+	if ctx.Done() == nil {
+		return func() error { return nil }
+	}
+	done := make(chan struct{})
+	result := make(chan error, 1)
+	go func() {
+		select {
+		case <-ctx.Done():
+			if mu != nil {
+				mu.Lock()
+				defer mu.Unlock()
 			}
+			conn.SetDeadline(time.Unix(1, 0))
+			result <- ctx.Err()
+		case <-done:
+			result <- nil
 		}
-		if err != nil {
-			return nil, err
-		}
+	}()
+	return func() error {
+		close(done)
+		return <-result
+	}
+}
+
+func (c *IMAPClient) StartTLS(config *tls.Config) error {
+	return c.StartTLSContext(context.Background(), config)
+}
+
+// ErrNoStartTLS is returned by StartTLS when the server does not advertise
+// STARTTLS, which may also mean that someone in between removed it.
+var ErrNoStartTLS = errors.New("Server does not support STARTTLS")
+
+// StartTLSContext upgrades the connection to TLS with STARTTLS. It fails
+// with ErrNoStartTLS, without sending the command, if the server does not
+// advertise it.
+func (c *IMAPClient) StartTLSContext(ctx context.Context, config *tls.Config) error {
+	if _, ok := c.tlsConn(); ok {
+		return errors.New("TLS already established")
+	}
+	if _, ok := c.conn.(*compressConn); ok {
+		return errors.New("Compression already active")
+	}
+	caps, err := c.capabilities(ctx)
+	if err != nil {
+		return err
+	}
+	if !caps.Has("STARTTLS") {
+		return ErrNoStartTLS
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	resp := c.executeLocked(ctx, "STARTTLS", nil, NewResponse())
+	if resp.Error() != nil {
+		return resp.Error()
+	}
+	conn := tls.Client(c.conn, config)
+	stop := watchContext(ctx, c.conn, nil)
+	err = conn.Handshake()
+	if cerr := stop(); cerr != nil {
+		err = cerr
+	}
+	if err != nil {
+		c.conn.Close()
+		return err
+	}
+	c.conn = conn
+	c.r = bufio.NewReaderSize(conn, c.r.Size())
+	c.caps = nil
+	return nil
+}
+
+// State reports the session state. A client whose server greeted with
+// PREAUTH starts out authenticated and needs no Login.
+func (c *IMAPClient) State() State {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.state
+}
+
+// TLSConnectionState returns the state of the TLS connection, if any.
+func (c *IMAPClient) TLSConnectionState() (tls.ConnectionState, bool) {
+	if conn, ok := c.tlsConn(); ok {
+		return conn.ConnectionState(), true
 	}
-	return &IMAPClient{
-		conn: c,
-		buf:  buf,
-	}, nil
+	return tls.ConnectionState{}, false
+}
+
+// tlsConn returns the TLS connection under any compression.
+func (c *IMAPClient) tlsConn() (*tls.Conn, bool) {
+	conn := c.conn
+	if compressed, ok := conn.(*compressConn); ok {
+		conn = compressed.Conn
+	}
+	tlsConn, ok := conn.(*tls.Conn)
+	return tlsConn, ok
 }
 
 func (c *IMAPClient) Close() error {
 	return c.conn.Close()
 }
 
+// Reconnect closes the current connection and dials the server again with
+// the Dialer that created c. The new session is not authenticated.
+func (c *IMAPClient) Reconnect() error {
+	return c.ReconnectContext(context.Background())
+}
+
+func (c *IMAPClient) ReconnectContext(ctx context.Context) error {
+	if c.redial == nil {
+		return errors.New("Client was not created by a Dialer")
+	}
+	n, err := c.redial(ctx)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.conn.Close()
+	c.conn = n.conn
+	c.r = n.r
+	c.count = 0
+	c.caps = n.caps
+	c.enabled = nil
+	c.delimiter = nil
+	c.greeting = n.greeting
+	c.state = n.state
+	c.mailbox = nil
+	c.lastUsed = n.lastUsed
+	return nil
+}
+
 func (c *IMAPClient) Do(cmd string) *Response {
+	return c.DoContext(context.Background(), cmd)
+}
+
+// DoContext is like Do, but gives up when ctx is done. Since the server's
+// reply is then left unread, the connection is closed in that case.
+func (c *IMAPClient) DoContext(ctx context.Context, cmd string) *Response {
+	return c.execute(ctx, cmd, nil)
+}
+
+// execute runs cmd like DoContext. Whenever the server sends a continuation
+// request, cont is called with its text and writes what to send next to w.
+// A command that gets a continuation request without a cont fails and
+// closes the connection, as does an error returned by cont.
+func (c *IMAPClient) execute(ctx context.Context, cmd string, cont func(w io.Writer, text string) error) *Response {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.executeLocked(ctx, cmd, cont, NewResponse())
+}
+
+// executeLocked runs cmd like execute, with c.mu held, reading the
+// response into ret.
+func (c *IMAPClient) executeLocked(ctx context.Context, cmd string, cont func(w io.Writer, text string) error, ret *Response) *Response {
+	if err := ctx.Err(); err != nil {
+		ret.err = err
+		return ret
+	}
+	if c.CommandTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.CommandTimeout)
+		defer cancel()
+	}
+	stop := watchContext(ctx, c.conn, &c.deadlineMu)
+	c.do(ctx, cmd, cont, ret)
+	c.update(cmd, ret)
+	c.lastUsed = time.Now()
+	if err := stop(); err != nil {
+		if ret.err == nil {
+			c.conn.SetDeadline(time.Time{})
+		} else {
+			ret.err = err
+			c.conn.Close()
+		}
+	}
+	return ret
+}
+
+func (c *IMAPClient) do(ctx context.Context, cmd string, cont func(w io.Writer, text string) error, ret *Response) *Response {
 	c.count++
 	cmd = fmt.Sprintf("a%03d %s\r\n", c.count, cmd)
-	ret := NewResponse()
 
-	_, err := c.conn.Write([]byte(cmd))
-	if err != nil {
+	if err := c.write(ctx, []byte(cmd)); err != nil {
 		ret.err = err
 		return ret
 	}
+	if ret.send != nil {
+		if err := ret.send(deadlineWriter{c, ctx}); err != nil {
+			c.conn.Close()
+			ret.err = err
+			return ret
+		}
+	}
 
 	for {
-		n, err := c.conn.Read(c.buf)
-		if err != nil {
+		if err := c.setDeadline(ctx, c.ReadTimeout, c.conn.SetReadDeadline); err != nil {
 			ret.err = err
 			return ret
 		}
-		isFinished, err := ret.Feed(c.buf[:n])
+		if _, err := c.r.Peek(1); err != nil {
+			ret.err = err
+			return ret
+		}
+		buf, _ := c.r.Peek(c.r.Buffered())
+		n, _, err := ret.feed(buf)
+		c.r.Discard(n)
 		if err != nil {
 			ret.err = err
 			return ret
 		}
-		if isFinished {
+		if ret.feedStatus == feedFinished {
 			break
 		}
+		if text, ok := ret.Continuation(); ok {
+			if cont == nil {
+				c.conn.Close()
+				ret.err = errors.New("Unexpected continuation request: " + text)
+				return ret
+			}
+			if err := cont(deadlineWriter{c, ctx}, text); err != nil {
+				c.conn.Close()
+				ret.err = err
+				return ret
+			}
+		}
 	}
 	return ret
 }
 
+// update records what resp to cmd tells about the session in c. The
+// modseq reported by SELECT and EXAMINE is the new mailbox's, which
+// selectMailbox records.
+func (c *IMAPClient) update(cmd string, resp *Response) {
+	c.updateCapabilities(resp)
+	if name := strings.ToUpper(strings.SplitN(cmd, " ", 2)[0]); name != "SELECT" && name != "EXAMINE" {
+		c.updateModSeq(resp)
+	}
+}
+
+func (c *IMAPClient) write(ctx context.Context, data []byte) error {
+	_, err := deadlineWriter{c, ctx}.Write(data)
+	return err
+}
+
+// deadlineWriter writes to the connection, applying WriteTimeout to each
+// Write.
+type deadlineWriter struct {
+	c   *IMAPClient
+	ctx context.Context
+}
+
+func (w deadlineWriter) Write(p []byte) (int, error) {
+	if err := w.c.setDeadline(w.ctx, w.c.WriteTimeout, w.c.conn.SetWriteDeadline); err != nil {
+		return 0, err
+	}
+	return w.c.conn.Write(p)
+}
+
+// setDeadline moves a read or write deadline timeout from now, or clears it
+// if timeout is zero, unless ctx is already done.
+func (c *IMAPClient) setDeadline(ctx context.Context, timeout time.Duration, set func(time.Time) error) error {
+	c.deadlineMu.Lock()
+	defer c.deadlineMu.Unlock()
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	var t time.Time
+	if timeout > 0 {
+		t = time.Now().Add(timeout)
+	}
+	return set(t)
+}
+
 func (c *IMAPClient) Login(user, password string) error {
-	resp := c.Do(fmt.Sprintf("LOGIN %s %s", user, password))
+	return c.LoginContext(context.Background(), user, password)
+}
+
+var ErrLoginDisabled = errors.New("Server disabled LOGIN on this unencrypted connection (LOGINDISABLED), use StartTLS first")
+
+// LoginContext authenticates with the LOGIN command. It does nothing if the
+// session is already authenticated, as after a PREAUTH greeting.
+func (c *IMAPClient) LoginContext(ctx context.Context, user, password string) error {
+	if c.State() != NotAuthenticatedState {
+		return nil
+	}
+	if _, ok := c.TLSConnectionState(); !ok && !c.AllowInsecureLogin {
+		caps, err := c.capabilities(ctx)
+		if err != nil {
+			return err
+		}
+		if caps["LOGINDISABLED"] {
+			return ErrLoginDisabled
+		}
+	}
+	c.mu.Lock()
+	caps := c.caps
+	c.caps = nil
+	c.mu.Unlock()
+	resp := c.commandCaps(ctx, caps, "LOGIN", quote(user), quote(password))
+	if resp.err == nil {
+		c.setState(AuthenticatedState, nil)
+	}
 	return resp.err
 }
 
-func (c *IMAPClient) Select(box string) *Response {
-	return c.Do(fmt.Sprintf("SELECT %s", box))
+func (c *IMAPClient) Select(box string) (*MailboxStatus, error) {
+	return c.SelectContext(context.Background(), box)
+}
+
+func (c *IMAPClient) SelectContext(ctx context.Context, box string) (*MailboxStatus, error) {
+	status, _, err := c.selectMailbox(ctx, "SELECT", box)
+	return status, err
+}
+
+func (c *IMAPClient) Examine(box string) (*MailboxStatus, error) {
+	return c.ExamineContext(context.Background(), box)
+}
+
+// ExamineContext selects box read-only. Until another mailbox is selected,
+// commands that would change it fail with ErrReadOnly without being sent.
+func (c *IMAPClient) ExamineContext(ctx context.Context, box string) (*MailboxStatus, error) {
+	status, _, err := c.selectMailbox(ctx, "EXAMINE", box)
+	return status, err
 }
 
-func (c *IMAPClient) Search(flag string) ([]string, error) {
-	resp := c.Do(fmt.Sprintf("SEARCH %s", flag))
+// Mailbox returns the state of the selected mailbox as reported by the
+// last SELECT or EXAMINE, or nil if no mailbox is selected. The status
+// returned is not changed later; call Mailbox again for updates.
+func (c *IMAPClient) Mailbox() *MailboxStatus {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.state != SelectedState {
+		return nil
+	}
+	return c.mailbox
+}
+
+// ReadOnly reports whether the selected mailbox was opened with EXAMINE or
+// the server only granted read-only access to it.
+func (c *IMAPClient) ReadOnly() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.state == SelectedState && c.mailbox != nil && c.mailbox.ReadOnly
+}
+
+// setState moves the session to state with mailbox selected, taking c.mu
+// to keep the change from racing with the keepalive.
+func (c *IMAPClient) setState(state State, mailbox *MailboxStatus) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.state = state
+	c.mailbox = mailbox
+}
+
+var ErrReadOnly = errors.New("Mailbox is selected read-only")
+
+// selectMailbox issues SELECT or EXAMINE with optional parameters and
+// updates the state: a failed one leaves no mailbox selected. It also
+// returns the response for parsing extension data.
+func (c *IMAPClient) selectMailbox(ctx context.Context, cmd, box string, params ...interface{}) (*MailboxStatus, *Response, error) {
+	resp := c.command(ctx, append([]interface{}{cmd, quote(EncodeMailbox(box))}, params...)...)
 	if resp.Error() != nil {
-		return nil, resp.Error()
+		c.mu.Lock()
+		if c.state == SelectedState {
+			c.state = AuthenticatedState
+		}
+		c.mailbox = nil
+		c.mu.Unlock()
+		return nil, nil, resp.Error()
 	}
+	status := &MailboxStatus{Name: box, ReadOnly: cmd == "EXAMINE"}
+	if err := status.parseSelect(resp); err != nil {
+		return nil, nil, err
+	}
+	c.setState(SelectedState, status)
+	return status, resp, nil
+}
+
+func (c *IMAPClient) Check() error {
+	return c.CheckContext(context.Background())
+}
+
+// CheckContext asks the server to checkpoint the selected mailbox, that is
+// to do any housekeeping such as writing its state to disk.
+func (c *IMAPClient) CheckContext(ctx context.Context) error {
+	return c.command(ctx, "CHECK").Error()
+}
+
+func (c *IMAPClient) Unselect() error {
+	return c.UnselectContext(context.Background())
+}
+
+// UnselectContext leaves the selected mailbox without expunging it, unlike
+// CLOSE. It needs the UNSELECT extension (RFC 3691).
+func (c *IMAPClient) UnselectContext(ctx context.Context) error {
+	resp := c.command(ctx, "UNSELECT")
+	if resp.Error() != nil {
+		return resp.Error()
+	}
+	c.setState(AuthenticatedState, nil)
+	return nil
+}
+
+func (c *IMAPClient) Noop() error {
+	return c.NoopContext(context.Background())
+}
+
+// NoopContext does nothing but gives the server a chance to report
+// changes, and resets its inactivity timer.
+func (c *IMAPClient) NoopContext(ctx context.Context) error {
+	return c.command(ctx, "NOOP").Error()
+}
+
+// KeepAlive sends NOOP from a separate goroutine whenever no command has
+// been issued for interval, so that the server and NATs or firewalls in
+// between do not drop an idle connection. It runs until stop is called or
+// a NOOP fails. Commands remain safe to issue meanwhile; they wait for a
+// NOOP in progress.
+func (c *IMAPClient) KeepAlive(interval time.Duration) (stop func()) {
+	done := make(chan struct{})
+	var once sync.Once
+	go func() {
+		t := time.NewTimer(interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-t.C:
+			}
+			c.mu.Lock()
+			idle := time.Since(c.lastUsed)
+			if idle >= interval {
+				if c.executeLocked(context.Background(), "NOOP", nil, NewResponse()).Error() != nil {
+					c.mu.Unlock()
+					return
+				}
+				idle = 0
+			}
+			c.mu.Unlock()
+			t.Reset(interval - idle)
+		}
+	}()
+	return func() {
+		once.Do(func() { close(done) })
+	}
+}
+
+func (c *IMAPClient) Search(criteria ...interface{}) ([]uint32, error) {
+	return c.SearchContext(context.Background(), criteria...)
+}
+
+// SearchContext returns the sequence numbers of the messages matching
+// criteria: strings sent verbatim, which must be atoms or sequence sets
+// such as "UNSEEN", SeqSets, Quoted strings or Literals for search terms,
+// and time.Time values for dates, as in
+//
+//	c.Search("SUBJECT", imap.Quoted("Grüße"), "SINCE", time.Now().AddDate(0, 0, -7))
+//
+// Where the server supports WITHIN (RFC 5032), OLDER and YOUNGER take a
+// time.Duration for messages by internal date relative to now, to the
+// second, as in c.Search("YOUNGER", time.Hour).
+//
+// Unless criteria start with "CHARSET", CHARSET UTF-8 is added when a
+// term is not ASCII.
+func (c *IMAPClient) SearchContext(ctx context.Context, criteria ...interface{}) ([]uint32, error) {
+	ids, _, err := c.search(ctx, "SEARCH", criteria)
+	return ids, err
+}
+
+// UIDSearch is like Search but returns UIDs rather than sequence numbers.
+func (c *IMAPClient) UIDSearch(criteria ...interface{}) ([]UID, error) {
+	return c.UIDSearchContext(context.Background(), criteria...)
+}
+
+func (c *IMAPClient) UIDSearchContext(ctx context.Context, criteria ...interface{}) ([]UID, error) {
+	nums, _, err := c.search(ctx, "UID SEARCH", criteria)
+	return toUIDs(nums), err
+}
+
+func toUIDs(nums []uint32) []UID {
+	if nums == nil {
+		return nil
+	}
+	uids := make([]UID, len(nums))
+	for i, n := range nums {
+		uids[i] = UID(n)
+	}
+	return uids
+}
+
+func (c *IMAPClient) SearchChangedSince(modSeq uint64, criteria ...interface{}) ([]uint32, uint64, error) {
+	return c.SearchChangedSinceContext(context.Background(), modSeq, criteria...)
+}
+
+// SearchChangedSinceContext is like SearchContext but only matches
+// messages whose mod-sequence is greater than modSeq (RFC 7162 CONDSTORE).
+// It also returns the highest mod-sequence of the matching messages, to
+// pass as modSeq next time.
+func (c *IMAPClient) SearchChangedSinceContext(ctx context.Context, modSeq uint64, criteria ...interface{}) ([]uint32, uint64, error) {
+	return c.search(ctx, "SEARCH", modSeqCriteria(modSeq, criteria))
+}
+
+// UIDSearchChangedSince is like SearchChangedSince but returns UIDs.
+func (c *IMAPClient) UIDSearchChangedSince(modSeq uint64, criteria ...interface{}) ([]UID, uint64, error) {
+	return c.UIDSearchChangedSinceContext(context.Background(), modSeq, criteria...)
+}
+
+func (c *IMAPClient) UIDSearchChangedSinceContext(ctx context.Context, modSeq uint64, criteria ...interface{}) ([]UID, uint64, error) {
+	nums, highest, err := c.search(ctx, "UID SEARCH", modSeqCriteria(modSeq, criteria))
+	return toUIDs(nums), highest, err
+}
+
+// modSeqCriteria adds the MODSEQ search key to criteria, after any
+// CHARSET specification.
+func modSeqCriteria(modSeq uint64, criteria []interface{}) []interface{} {
+	key := []interface{}{"MODSEQ", strconv.FormatUint(modSeq, 10)}
+	if len(criteria) > 1 {
+		if first, ok := criteria[0].(string); ok && strings.EqualFold(first, "CHARSET") {
+			return append(criteria[:2:2], append(key, criteria[2:]...)...)
+		}
+	}
+	return append(key, criteria...)
+}
+
+// search issues SEARCH and returns the numbers it found, and the highest
+// mod-sequence the server reports when searching by MODSEQ.
+func (c *IMAPClient) search(ctx context.Context, cmd string, criteria []interface{}) ([]uint32, uint64, error) {
+	if err := checkCriteria(criteria); err != nil {
+		return nil, 0, err
+	}
+	args := []interface{}{cmd}
+	if needsCharset(criteria) {
+		args = append(args, "CHARSET", "UTF-8")
+	}
+	resp := c.command(ctx, append(args, criteria...)...)
+	if resp.Error() != nil {
+		return nil, 0, resp.Error()
+	}
+	return searchResults(resp, "SEARCH")
+}
+
+// searchResults parses the untagged SEARCH or SORT response in resp.
+func searchResults(resp *Response, name string) ([]uint32, uint64, error) {
 	for _, reply := range resp.Replys() {
-		org := reply.Origin()
-		if len(org) >= 6 && strings.ToUpper(org[:6]) == "SEARCH" {
-			ids := strings.Trim(org[6:], " \t\n\r")
-			if ids == "" {
-				return nil, nil
+		args, ok := replyArgs(reply, name)
+		if !ok {
+			continue
+		}
+		fields, err := parseFields(args)
+		if err != nil {
+			continue
+		}
+		var ids []uint32
+		var modSeq uint64
+		for _, field := range fields {
+			if list := asList(field); len(list) == 2 && strings.EqualFold(asString(list[0]), "MODSEQ") {
+				modSeq, _ = asNumber64(list[1])
+				continue
+			}
+			id, ok := asNumber(field)
+			if !ok {
+				return nil, 0, errors.New("Invalid " + name + " response: " + reply.Origin())
 			}
-			return strings.Split(ids, " "), nil
+			ids = append(ids, id)
 		}
+		return ids, modSeq, nil
 	}
-	return nil, errors.New("Invalid response")
+	return nil, 0, errors.New("Invalid response")
 }
 
-func (c *IMAPClient) Fetch(id, arg string) (string, error) {
-	resp := c.Do(fmt.Sprintf("FETCH %s %s", id, arg))
+// needsCharset reports whether criteria contain a term that is not ASCII
+// and do not specify a CHARSET.
+func needsCharset(criteria []interface{}) bool {
+	if len(criteria) == 0 {
+		return false
+	}
+	if first, ok := criteria[0].(string); ok && strings.EqualFold(first, "CHARSET") {
+		return false
+	}
+	for _, arg := range criteria {
+		switch arg := arg.(type) {
+		case Quoted:
+			for i := 0; i < len(arg); i++ {
+				if arg[i] >= 0x80 {
+					return true
+				}
+			}
+		case Literal:
+			return true
+		}
+	}
+	return false
+}
+
+func (c *IMAPClient) Fetch(set SeqSet, arg string) (string, error) {
+	return c.FetchContext(context.Background(), set, arg)
+}
+
+// FetchContext fetches arg and returns the data of the first message in
+// set the server reports.
+func (c *IMAPClient) FetchContext(ctx context.Context, set SeqSet, arg string) (string, error) {
+	return c.fetch(ctx, "FETCH", set, arg)
+}
+
+// UIDFetch is like Fetch but takes UIDs.
+func (c *IMAPClient) UIDFetch(set SeqSet, arg string) (string, error) {
+	return c.UIDFetchContext(context.Background(), set, arg)
+}
+
+func (c *IMAPClient) UIDFetchContext(ctx context.Context, set SeqSet, arg string) (string, error) {
+	return c.fetch(ctx, "UID FETCH", set, arg)
+}
+
+func (c *IMAPClient) fetch(ctx context.Context, cmd string, set SeqSet, arg string) (string, error) {
+	resp := c.command(ctx, cmd, set, arg)
 	if resp.Error() != nil {
 		return "", resp.Error()
 	}
 	for _, reply := range resp.Replys() {
-		org := reply.Origin()
-		if len(org) < len(id) || org[:len(id)] != id {
-			continue
+		id, items, ok := fetchItems(reply)
+		if ok && cmd == "UID FETCH" {
+			id, ok = asNumber(fetchItem(items, "UID"))
 		}
-		org = org[len(id)+1:]
-		if len(org) >= 5 && strings.ToUpper(org[:5]) == "FETCH" {
+		if ok && (set.saved || set.Contains(id)) {
 			body := reply.Content()
 			i := strings.Index(body, "\n")
 			return body[i+1:], nil
@@ -134,39 +858,83 @@ func (c *IMAPClient) Fetch(id, arg string) (string, error) {
 	return "", errors.New("Invalid response")
 }
 
-func (c *IMAPClient) StoreFlag(id, flag string) error {
-	resp := c.Do(fmt.Sprintf("STORE %s FLAGS %s", id, flag))
-	return resp.Error()
+func (c *IMAPClient) StoreFlag(set SeqSet, flag string) error {
+	return c.StoreFlagContext(context.Background(), set, flag)
+}
+
+func (c *IMAPClient) StoreFlagContext(ctx context.Context, set SeqSet, flag string) error {
+	return c.storeFlag(ctx, "STORE", set, flag)
+}
+
+// UIDStoreFlag is like StoreFlag but takes UIDs.
+func (c *IMAPClient) UIDStoreFlag(set SeqSet, flag string) error {
+	return c.UIDStoreFlagContext(context.Background(), set, flag)
+}
+
+func (c *IMAPClient) UIDStoreFlagContext(ctx context.Context, set SeqSet, flag string) error {
+	return c.storeFlag(ctx, "UID STORE", set, flag)
+}
+
+func (c *IMAPClient) storeFlag(ctx context.Context, cmd string, set SeqSet, flag string) error {
+	if c.ReadOnly() {
+		return ErrReadOnly
+	}
+	return c.command(ctx, cmd, set, "FLAGS", flag).Error()
 }
 
 func (c *IMAPClient) Logout() error {
-	resp := c.Do("LOGOUT")
+	return c.LogoutContext(context.Background())
+}
+
+func (c *IMAPClient) LogoutContext(ctx context.Context) error {
+	resp := c.DoContext(ctx, "LOGOUT")
+	c.setState(LogoutState, nil)
 	return resp.Error()
 }
 
 func (c *IMAPClient) GetMessage(id string) (*mail.Message, error) {
-	headerResp := c.Do(fmt.Sprintf("FETCH %s %s", id, RFC822Header))
-	if headerResp.Error() != nil {
-		return nil, headerResp.Error()
-	}
+	return c.GetMessageContext(context.Background(), id)
+}
 
-	replys := headerResp.Replys()
+// GetMessageContext fetches a whole message with BODY.PEEK[], which does
+// not set the \Seen flag.
+func (c *IMAPClient) GetMessageContext(ctx context.Context, id string) (*mail.Message, error) {
+	return c.getMessage(ctx, "FETCH", id)
+}
 
-	reader := textproto.NewReader(bufio.NewReader(bytes.NewBuffer(replys[0].content)))
-	header, err := reader.ReadMIMEHeader()
-	if err != nil {
-		return nil, err
-	}
+// UIDGetMessage is like GetMessage but takes the UID of the message, which
+// unlike its sequence number stays valid when other messages are expunged.
+func (c *IMAPClient) UIDGetMessage(uid string) (*mail.Message, error) {
+	return c.UIDGetMessageContext(context.Background(), uid)
+}
 
-	bodyResp := c.Do(fmt.Sprintf("FETCH %s %s", id, RFC822Text))
-	if bodyResp.Error() != nil {
-		return nil, bodyResp.Error()
-	}
+func (c *IMAPClient) UIDGetMessageContext(ctx context.Context, uid string) (*mail.Message, error) {
+	return c.getMessage(ctx, "UID FETCH", uid)
+}
 
-	return &mail.Message{
-		Header: mail.Header(header),
-		Body:   bytes.NewBuffer(bodyResp.Replys()[0].content),
-	}, nil
+// getMessage fetches the message in one command and splits header and
+// body locally.
+func (c *IMAPClient) getMessage(ctx context.Context, cmd, id string) (*mail.Message, error) {
+	resp := c.command(ctx, cmd, id, "BODY.PEEK[]")
+	if resp.Error() != nil {
+		return nil, resp.Error()
+	}
+	for _, reply := range resp.Replys() {
+		var data []byte
+		if reply.literals > 0 {
+			data = reply.content
+		} else if _, items, ok := fetchItems(reply); ok {
+			value, ok := fetchItem(items, "BODY[]").(string)
+			if !ok {
+				continue
+			}
+			data = []byte(value)
+		} else {
+			continue
+		}
+		return mail.ReadMessage(bytes.NewReader(data))
+	}
+	return nil, errors.New("No such message " + id)
 }
 
 type reply struct {
@@ -174,6 +942,8 @@ type reply struct {
 	type_   []byte
 	length  []byte
 	content []byte
+
+	literals int
 }
 
 func newReply() (ret reply) {
@@ -207,12 +977,12 @@ const (
 	feedInit feedStatus = iota
 	feedStar
 	feedReply
-	feedReplyType
-	feedReplyLength
 	feedReplyContent
 	feedReplyMeet0d
 	feedStatusLine
 	feedStatusLineMeet0d
+	feedContinuation
+	feedContinuationMeet0d
 	feedFinished
 )
 
@@ -222,10 +992,26 @@ type Response struct {
 	err    error
 	replys []reply
 
+	continuation *string
+
 	buf              []byte
 	feedStatus       feedStatus
+	literalLeft      int
 	parenthesisCount int
 	reply            reply
+
+	// stream, if set, receives the literals for which streamIf, given the
+	// reply up to the literal, returns true, instead of the reply's origin
+	// and content.
+	stream    io.Writer
+	streamIf  func(prefix string) bool
+	streaming bool
+	streamed  int64
+	streamErr error
+
+	// send, if set, writes what follows the command line without waiting
+	// for a continuation request, as for non-synchronizing literals.
+	send func(w io.Writer) error
 }
 
 func NewResponse() *Response {
@@ -237,11 +1023,23 @@ func NewResponse() *Response {
 }
 
 func (r *Response) Feed(input []byte) (bool, error) {
-	for _, i := range input {
+	_, finished, err := r.feed(input)
+	return finished, err
+}
+
+// feed is like Feed but also reports how much of input was consumed, so
+// that bytes following the tagged status line or a continuation request
+// are left for the next reader.
+func (r *Response) feed(input []byte) (int, bool, error) {
+	r.continuation = nil
+	for n := 0; n < len(input); n++ {
+		i := input[n]
 		switch r.feedStatus {
 		case feedInit:
 			if i == byte('*') {
 				r.feedStatus = feedStar
+			} else if i == byte('+') {
+				r.feedStatus = feedContinuation
 			} else {
 				r.feedStatus = feedStatusLine
 				r.buf = append(r.buf, i)
@@ -253,53 +1051,76 @@ func (r *Response) Feed(input []byte) (bool, error) {
 				r.reply.origin = append(r.reply.origin, i)
 			}
 		case feedReply:
-			switch i {
-			case byte('\r'):
+			if i == byte('\r') {
 				r.feedStatus = feedReplyMeet0d
-			case byte('('):
-				r.feedStatus = feedReplyType
-				r.reply.origin = append(r.reply.origin, i)
-			default:
+			} else {
 				r.reply.origin = append(r.reply.origin, i)
 			}
-		case feedReplyType:
-			switch i {
-			case byte(')'):
-				r.feedStatus = feedReply
-			case byte(' '):
-				if len(r.reply.type_) > 0 {
-					r.feedStatus = feedReplyLength
-				}
-			default:
-				r.reply.type_ = append(r.reply.type_, i)
-			}
-			r.reply.origin = append(r.reply.origin, i)
-		case feedReplyLength:
-			r.reply.origin = append(r.reply.origin, i)
-			if i == byte('\n') {
-				r.feedStatus = feedReplyContent
-			}
-			if byte('0') <= i && i <= byte('9') {
-				r.reply.length = append(r.reply.length, i)
-			}
 		case feedReplyContent:
-			r.reply.origin = append(r.reply.origin, i)
-			r.reply.content = append(r.reply.content, i)
-			i, err := r.reply.Length()
-			if err != nil {
-				return false, errors.New("Parse response error, reply need a valid length number")
+			end := n + r.literalLeft
+			if end > len(input) {
+				end = len(input)
+			}
+			chunk := input[n:end]
+			if r.streaming {
+				if r.streamErr == nil {
+					var written int
+					written, r.streamErr = r.stream.Write(chunk)
+					r.streamed += int64(written)
+				}
+			} else {
+				r.reply.origin = append(r.reply.origin, chunk...)
+				if r.reply.literals == 1 {
+					r.reply.content = append(r.reply.content, chunk...)
+				}
 			}
-			if len(r.reply.content) == i {
+			r.literalLeft -= len(chunk)
+			if r.literalLeft == 0 {
 				r.feedStatus = feedReply
+				r.streaming = false
 			}
+			n = end - 1
 		case feedReplyMeet0d:
 			if i == byte('\n') {
-				r.feedStatus = feedInit
-				r.replys = append(r.replys, r.reply)
-				r.buf = r.buf[0:0]
+				size, ok := literalSize(r.reply.origin)
+				if !ok {
+					r.feedStatus = feedInit
+					r.replys = append(r.replys, r.reply)
+					r.buf = r.buf[0:0]
+					break
+				}
+				if size < 0 {
+					return n, false, errors.New("Parse response error, reply need a valid length number")
+				}
+				r.reply.literals++
+				if r.reply.literals == 1 {
+					r.reply.type_, r.reply.length = literalName(r.reply.origin)
+				}
+				start := bytes.LastIndexByte(r.reply.origin, byte('{'))
+				if start > 0 && r.reply.origin[start-1] == byte('~') {
+					start--
+				}
+				if r.stream != nil && start > 0 && r.streamIf(string(r.reply.origin[:start])) {
+					// The literal goes to the stream; leave an empty
+					// string in its place so that origin still parses.
+					r.reply.origin = append(r.reply.origin[:start], byte('"'), byte('"'))
+					r.streaming = size > 0
+					r.literalLeft = size
+					r.feedStatus = feedReply
+					if size > 0 {
+						r.feedStatus = feedReplyContent
+					}
+					break
+				}
+				r.reply.origin = append(r.reply.origin, byte('\r'), byte('\n'))
+				r.literalLeft = size
+				r.feedStatus = feedReplyContent
+				if size == 0 {
+					r.feedStatus = feedReply
+				}
 			} else {
 				r.feedStatus = feedReply
-				r.reply.origin = append(r.reply.origin, i)
+				r.reply.origin = append(r.reply.origin, byte('\r'), i)
 			}
 		case feedStatusLine:
 			if i == byte('\r') {
@@ -318,18 +1139,95 @@ func (r *Response) Feed(input []byte) (bool, error) {
 					r.status = array[1]
 				}
 				if len(r.status) < 3 || r.status[:3] != "OK " {
-					r.err = errors.New(r.status)
+					status := strings.SplitN(r.status, " ", 2)
+					e := &StatusError{Status: strings.ToUpper(status[0])}
+					if len(status) > 1 {
+						e.Text = status[1]
+					}
+					r.err = e
 				}
-				return true, nil
+				return n + 1, true, nil
 			} else {
 				r.feedStatus = feedStatusLine
 				r.buf = append(r.buf, byte('\r'), i)
 			}
+		case feedContinuation:
+			if i == byte('\r') {
+				r.feedStatus = feedContinuationMeet0d
+			} else {
+				r.buf = append(r.buf, i)
+			}
+		case feedContinuationMeet0d:
+			if i == byte('\n') {
+				text := strings.TrimPrefix(string(r.buf), " ")
+				r.continuation = &text
+				r.buf = r.buf[0:0]
+				r.feedStatus = feedInit
+				return n + 1, true, nil
+			} else {
+				r.feedStatus = feedContinuation
+				r.buf = append(r.buf, byte('\r'), i)
+			}
 		case feedFinished:
-			return true, errors.New("Need no more feed")
+			return n, true, errors.New("Need no more feed")
+		}
+	}
+	return len(input), false, nil
+}
+
+// literalSize reports whether line ends with a literal announcement such
+// as {42}, ~{42} or {42+}, and its size, which is -1 if it is too large.
+// A line ending in braces around anything but digits, as text may, is not
+// a literal.
+func literalSize(line []byte) (int, bool) {
+	if len(line) == 0 || line[len(line)-1] != byte('}') {
+		return 0, false
+	}
+	start := bytes.LastIndexByte(line, byte('{'))
+	if start < 0 {
+		return 0, false
+	}
+	digits := bytes.TrimSuffix(line[start+1:len(line)-1], []byte("+"))
+	if len(digits) == 0 {
+		return 0, false
+	}
+	for _, b := range digits {
+		if b < '0' || b > '9' {
+			return 0, false
+		}
+	}
+	size, err := strconv.Atoi(string(digits))
+	if err != nil {
+		return -1, true
+	}
+	return size, true
+}
+
+// literalName returns the data item name preceding the literal
+// announcement at the end of line, such as BODY[HEADER], and the digits of
+// the announced size.
+func literalName(line []byte) ([]byte, []byte) {
+	start := bytes.LastIndexByte(line, byte('{'))
+	length := append([]byte{}, bytes.TrimSuffix(line[start+1:len(line)-1], []byte("+"))...)
+	end := start
+	if end > 0 && line[end-1] == byte('~') {
+		end--
+	}
+	for end > 0 && line[end-1] == byte(' ') {
+		end--
+	}
+	i, depth := end, 0
+	for ; i > 0; i-- {
+		b := line[i-1]
+		if b == byte(']') {
+			depth++
+		} else if b == byte('[') {
+			depth--
+		} else if depth == 0 && (b == byte(' ') || b == byte('(')) {
+			break
 		}
 	}
-	return false, nil
+	return append([]byte{}, line[i:end]...), length
 }
 
 func (r *Response) Id() string {
@@ -344,6 +1242,17 @@ func (r *Response) Error() error {
 	return r.err
 }
 
+// Continuation reports whether the input fed last ended with a
+// continuation request from the server, and its text. Feed returns true
+// after such a request although the response is not finished; the
+// request must be answered before feeding more.
+func (r *Response) Continuation() (string, bool) {
+	if r.continuation == nil {
+		return "", false
+	}
+	return *r.continuation, true
+}
+
 func (r *Response) Replys() []reply {
 	return r.replys
 }
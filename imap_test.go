@@ -0,0 +1,194 @@
+package imap
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeServer is the server end of a connection to a client under test,
+// driven by a script.
+type fakeServer struct {
+	t    *testing.T
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+// readLine reads a line from the client and returns it without its CRLF.
+func (s *fakeServer) readLine() string {
+	line, err := s.r.ReadString('\n')
+	if err != nil {
+		s.t.Errorf("server read: %v", err)
+	}
+	return strings.TrimRight(line, "\r\n")
+}
+
+// expect reads a command, checks it is want apart from its tag, and
+// returns the tag.
+func (s *fakeServer) expect(want string) string {
+	line := s.readLine()
+	parts := strings.SplitN(line, " ", 2)
+	if len(parts) != 2 || parts[1] != want {
+		s.t.Errorf("got command %q, want %q", line, want)
+	}
+	return parts[0]
+}
+
+func (s *fakeServer) write(lines ...string) {
+	for _, line := range lines {
+		if _, err := s.conn.Write([]byte(line + "\r\n")); err != nil {
+			s.t.Errorf("server write: %v", err)
+			return
+		}
+	}
+}
+
+// testClient returns a client connected to a fakeServer that sends greeting
+// and then runs script.
+func testClient(t *testing.T, greeting string, script func(s *fakeServer)) *IMAPClient {
+	clientConn, serverConn := net.Pipe()
+	s := &fakeServer{t: t, conn: serverConn, r: bufio.NewReader(serverConn)}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.write(greeting)
+		script(s)
+	}()
+	c, err := NewClientPlain(clientConn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		c.Close()
+		serverConn.Close()
+		<-done
+	})
+	return c
+}
+
+func TestKeepAliveConcurrentState(t *testing.T) {
+	c := testClient(t, "* OK ready", func(s *fakeServer) {
+		for {
+			line, err := s.r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			parts := strings.Fields(line)
+			if len(parts) < 2 {
+				continue
+			}
+			if parts[1] == "CAPABILITY" {
+				s.write("* CAPABILITY IMAP4rev1 IDLE")
+			}
+			s.write(parts[0] + " OK [CAPABILITY IMAP4rev1 IDLE] done")
+		}
+	})
+	c.AllowInsecureLogin = true
+	stop := c.KeepAlive(time.Millisecond)
+	defer stop()
+	for i := 0; i < 20; i++ {
+		c.Supports("IDLE")
+		c.State()
+		time.Sleep(time.Millisecond)
+	}
+	if err := c.Login("user", "pass"); err != nil {
+		t.Fatal(err)
+	}
+	if c.State() != AuthenticatedState {
+		t.Fatal("not authenticated")
+	}
+}
+
+func TestLiteralSize(t *testing.T) {
+	tests := []struct {
+		line string
+		size int
+		ok   bool
+	}{
+		{"* 1 FETCH (BODY[] {42}", 42, true},
+		{"* 1 FETCH (BODY[] ~{0}", 0, true},
+		{"* 1 FETCH (BODY[] {7+}", 7, true},
+		{"* 1 FETCH (BODY[] {99999999999999999999}", -1, true},
+		{"* OK [ALERT] use {braces}", 0, false},
+		{`* 1 FETCH (ENVELOPE (NIL "a {b}"`, 0, false},
+		{"* OK {}", 0, false},
+		{"* OK {+}", 0, false},
+		{"* OK {-1}", 0, false},
+		{"* OK }", 0, false},
+		{"", 0, false},
+	}
+	for _, test := range tests {
+		size, ok := literalSize([]byte(test.line))
+		if size != test.size || ok != test.ok {
+			t.Errorf("%q: got %d, %v", test.line, size, ok)
+		}
+	}
+}
+
+func TestResponseFeed(t *testing.T) {
+	input := "* OK [ALERT] Maintenance {tonight}\r\n" +
+		"* 1 FETCH (UID 7 BODY[HEADER] {11}\r\nSubject: a\n FLAGS (\\Seen))\r\n" +
+		"* 2 FETCH (BODY[] ~{3}\r\n}\r\n)\r\n" +
+		"a001 OK done\r\n"
+	// Feed it in small pieces, as reads may split it anywhere.
+	for _, step := range []int{1, 3, 7, len(input)} {
+		r := NewResponse()
+		finished := false
+		var err error
+		for i := 0; i < len(input) && !finished; i += step {
+			end := i + step
+			if end > len(input) {
+				end = len(input)
+			}
+			finished, err = r.Feed([]byte(input[i:end]))
+			if err != nil {
+				t.Fatalf("step %d: %v", step, err)
+			}
+		}
+		replys := r.Replys()
+		if !finished || r.Error() != nil || len(replys) != 3 {
+			t.Fatalf("step %d: got %d replies, %v", step, len(replys), r.Error())
+		}
+		if replys[1].Type() != "BODY[HEADER]" || replys[1].Content() != "Subject: a\n" {
+			t.Errorf("step %d: got %q %q", step, replys[1].Type(), replys[1].Content())
+		}
+		if replys[2].Content() != "}\r\n" {
+			t.Errorf("step %d: got %q", step, replys[2].Content())
+		}
+	}
+}
+
+func TestStatusError(t *testing.T) {
+	c := testClient(t, "* PREAUTH ready", func(s *fakeServer) {
+		tag := s.expect("NOOP")
+		s.write(tag + " BAD [CLIENTBUG] Try again")
+	})
+	err := c.Noop()
+	statusErr, ok := err.(*StatusError)
+	if !ok || statusErr.Status != "BAD" || statusErr.Text != "[CLIENTBUG] Try again" || err.Error() != "BAD [CLIENTBUG] Try again" {
+		t.Errorf("got %#v", err)
+	}
+}
+
+func TestStartTLSNotAdvertised(t *testing.T) {
+	clientConn, serverConn := net.Pipe()
+	s := &fakeServer{t: t, conn: serverConn, r: bufio.NewReader(serverConn)}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.write("* OK [CAPABILITY IMAP4rev1 LOGINDISABLED] ready")
+		// The client sends nothing and closes the connection.
+		s.expectNothing()
+	}()
+	if _, err := NewClientStartTLS(clientConn, "imap.example.com"); err != ErrNoStartTLS {
+		t.Errorf("got %v, want ErrNoStartTLS", err)
+	}
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Error("connection left open")
+		serverConn.Close()
+	}
+}
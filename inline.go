@@ -0,0 +1,80 @@
+package imap
+
+import (
+	"context"
+	"encoding/base64"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// ContentIDs maps the Content-ID of each part of bs, without angle
+// brackets, to its part number, for resolving cid: URLs in HTML bodies.
+func (bs *BodyStructure) ContentIDs() map[string]string {
+	ids := make(map[string]string)
+	bs.walk("", func(number string, part *BodyStructure) error {
+		if id := strings.Trim(part.ID, "<> "); id != "" {
+			ids[id] = number
+		}
+		return nil
+	})
+	return ids
+}
+
+var cidURL = regexp.MustCompile(`(?i)\bcid:([^"'\s()<>]+)`)
+
+func (c *IMAPClient) InlineContentIDs(uid UID, html string) (string, error) {
+	return c.InlineContentIDsContext(context.Background(), uid, html)
+}
+
+// InlineContentIDsContext replaces the cid: URLs (RFC 2392) in html, an
+// HTML body of the message with the given UID, with data: URLs holding the
+// content of the parts they refer to, so the HTML renders on its own. Only
+// referenced parts are fetched; URLs that match no part are left as is.
+func (c *IMAPClient) InlineContentIDsContext(ctx context.Context, uid UID, html string) (string, error) {
+	refs := cidURL.FindAllStringSubmatch(html, -1)
+	if len(refs) == 0 {
+		return html, nil
+	}
+	bs, err := c.bodyStructure(ctx, uid)
+	if err != nil {
+		return "", err
+	}
+	ids := bs.ContentIDs()
+	inlined := make(map[string]string)
+	for _, ref := range refs {
+		if _, ok := inlined[ref[0]]; ok {
+			continue
+		}
+		inlined[ref[0]] = ref[0]
+		id, err := url.PathUnescape(ref[1])
+		if err != nil {
+			continue
+		}
+		number, ok := ids[id]
+		if !ok {
+			continue
+		}
+		part := partByNumber(bs, number)
+		data, err := c.fetchPart(ctx, uid, number, part)
+		if err != nil {
+			return "", err
+		}
+		inlined[ref[0]] = "data:" + part.MediaType() + ";base64," + base64.StdEncoding.EncodeToString(data)
+	}
+	return cidURL.ReplaceAllStringFunc(html, func(ref string) string {
+		return inlined[ref]
+	}), nil
+}
+
+// partByNumber returns the leaf part of bs with the given number.
+func partByNumber(bs *BodyStructure, number string) *BodyStructure {
+	var found *BodyStructure
+	bs.walk("", func(n string, part *BodyStructure) error {
+		if n == number {
+			found = part
+		}
+		return nil
+	})
+	return found
+}
@@ -0,0 +1,38 @@
+package imap
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCIDURL(t *testing.T) {
+	for _, tt := range []struct {
+		html string
+		ids  []string
+	}{
+		{`<img src="cid:logo@example.com">`, []string{"logo@example.com"}},
+		{`<img src=CID:a%40b>`, []string{"a%40b"}},
+		{`<div style="background: url(cid:bg)">`, []string{"bg"}},
+		{`Hydrochloric acid:HCl`, nil},
+		{`<a href="mailto:x@decid:y">`, nil},
+	} {
+		var ids []string
+		for _, m := range cidURL.FindAllStringSubmatch(tt.html, -1) {
+			ids = append(ids, m[1])
+		}
+		if !reflect.DeepEqual(ids, tt.ids) {
+			t.Errorf("%s: got %q, want %q", tt.html, ids, tt.ids)
+		}
+	}
+}
+
+func TestInlineContentIDsNoReference(t *testing.T) {
+	c := testClient(t, "* PREAUTH ready", func(s *fakeServer) {
+		s.expectNothing()
+	})
+	html := `<p>acid:base</p>`
+	if got, err := c.InlineContentIDs(1, html); err != nil || got != html {
+		t.Errorf("got %q, %v", got, err)
+	}
+	c.Close()
+}
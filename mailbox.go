@@ -0,0 +1,502 @@
+package imap
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+)
+
+const (
+	NoInferiors   = "\\Noinferiors"
+	NoSelect      = "\\Noselect"
+	Marked        = "\\Marked"
+	Unmarked      = "\\Unmarked"
+	HasChildren   = "\\HasChildren"
+	HasNoChildren = "\\HasNoChildren"
+	NonExistent   = "\\NonExistent"
+)
+
+// MailboxInfo is one entry of a LIST response.
+type MailboxInfo struct {
+	Attributes []string
+	// Delimiter is the hierarchy delimiter, or empty if the server has no
+	// hierarchy.
+	Delimiter string
+	// Name is the decoded UTF-8 name.
+	Name string
+}
+
+func (info *MailboxInfo) HasAttr(attr string) bool {
+	for _, a := range info.Attributes {
+		if strings.EqualFold(a, attr) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *IMAPClient) List(ref, pattern string) ([]*MailboxInfo, error) {
+	return c.ListContext(context.Background(), ref, pattern)
+}
+
+// ListContext issues LIST with the reference name and mailbox pattern,
+// where "*" matches any part of a name and "%" any part of one hierarchy
+// level. List("", "*") returns all mailboxes.
+func (c *IMAPClient) ListContext(ctx context.Context, ref, pattern string) ([]*MailboxInfo, error) {
+	resp := c.command(ctx, "LIST", quote(EncodeMailbox(ref)), quote(EncodeMailbox(pattern)))
+	if resp.Error() != nil {
+		return nil, resp.Error()
+	}
+	return parseMailboxList(resp, "LIST")
+}
+
+func parseMailboxList(resp *Response, name string) ([]*MailboxInfo, error) {
+	var list []*MailboxInfo
+	for _, reply := range resp.Replys() {
+		args, ok := replyArgs(reply, name)
+		if !ok {
+			continue
+		}
+		fields, err := parseFields(args)
+		if err != nil || len(fields) < 3 {
+			continue
+		}
+		info, err := parseMailboxInfo(fields)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, info)
+	}
+	return list, nil
+}
+
+func parseMailboxInfo(fields []interface{}) (*MailboxInfo, error) {
+	attrs, ok := fields[0].([]interface{})
+	if !ok {
+		return nil, errors.New("Invalid mailbox attributes in LIST response")
+	}
+	info := &MailboxInfo{
+		Delimiter: asString(fields[1]),
+		Name:      asString(fields[2]),
+	}
+	for _, attr := range attrs {
+		info.Attributes = append(info.Attributes, asString(attr))
+	}
+	if name, err := DecodeMailbox(info.Name); err == nil {
+		info.Name = name
+	}
+	if strings.EqualFold(info.Name, Inbox) {
+		info.Name = Inbox
+	}
+	return info, nil
+}
+
+func (c *IMAPClient) Create(name string) error {
+	return c.CreateContext(context.Background(), name)
+}
+
+func (c *IMAPClient) CreateContext(ctx context.Context, name string) error {
+	return c.command(ctx, "CREATE", quote(EncodeMailbox(name))).Error()
+}
+
+func (c *IMAPClient) CreateAll(name string) error {
+	return c.CreateAllContext(context.Background(), name)
+}
+
+// CreateAllContext creates name along with any missing parent mailboxes,
+// like mkdir -p.
+func (c *IMAPClient) CreateAllContext(ctx context.Context, name string) error {
+	delim, err := c.DelimiterContext(ctx)
+	if err != nil {
+		return err
+	}
+	parts := []string{name}
+	if delim != "" {
+		parts = strings.Split(strings.TrimSuffix(name, delim), delim)
+	}
+	for i := range parts {
+		path := strings.Join(parts[:i+1], delim)
+		exists, err := c.mailboxExists(ctx, path)
+		if err != nil {
+			return err
+		}
+		if exists {
+			continue
+		}
+		err = c.CreateContext(ctx, path)
+		if statusErr, ok := err.(*StatusError); ok {
+			if code, _ := responseCode(statusErr.Text); code == "ALREADYEXISTS" {
+				continue
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// mailboxExists reports whether LIST finds name. A name with the
+// wildcards % or * cannot be listed on its own and is reported missing,
+// leaving it to CREATE to tell with [ALREADYEXISTS].
+func (c *IMAPClient) mailboxExists(ctx context.Context, name string) (bool, error) {
+	if strings.ContainsAny(name, "%*") {
+		return false, nil
+	}
+	list, err := c.ListContext(ctx, "", name)
+	if err != nil {
+		return false, err
+	}
+	for _, info := range list {
+		if (info.Name == name || info.Name == Inbox && strings.EqualFold(name, Inbox)) && !info.HasAttr(NonExistent) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (c *IMAPClient) Delete(name string) error {
+	return c.DeleteContext(context.Background(), name)
+}
+
+func (c *IMAPClient) DeleteContext(ctx context.Context, name string) error {
+	return c.command(ctx, "DELETE", quote(EncodeMailbox(name))).Error()
+}
+
+func (c *IMAPClient) Rename(from, to string) error {
+	return c.RenameContext(context.Background(), from, to)
+}
+
+func (c *IMAPClient) RenameContext(ctx context.Context, from, to string) error {
+	return c.command(ctx, "RENAME", quote(EncodeMailbox(from)), quote(EncodeMailbox(to))).Error()
+}
+
+func (c *IMAPClient) Delimiter() (string, error) {
+	return c.DelimiterContext(context.Background())
+}
+
+// DelimiterContext returns the hierarchy delimiter of the server's
+// mailbox names, or "" if it has no hierarchy. It is asked for once with
+// LIST "" "" and then cached.
+func (c *IMAPClient) DelimiterContext(ctx context.Context) (string, error) {
+	c.mu.Lock()
+	delimiter := c.delimiter
+	c.mu.Unlock()
+	if delimiter != nil {
+		return *delimiter, nil
+	}
+	list, err := c.ListContext(ctx, "", "")
+	if err != nil {
+		return "", err
+	}
+	delim := ""
+	if len(list) > 0 {
+		delim = list[0].Delimiter
+	}
+	c.mu.Lock()
+	c.delimiter = &delim
+	c.mu.Unlock()
+	return delim, nil
+}
+
+// Namespace is a mailbox name prefix and the hierarchy delimiter used
+// below it, as in "INBOX." and ".".
+type Namespace struct {
+	Prefix    string
+	Delimiter string
+}
+
+// Namespaces lists the personal namespaces of the user, those of other
+// users and shared ones (RFC 2342).
+type Namespaces struct {
+	Personal []Namespace
+	Other    []Namespace
+	Shared   []Namespace
+}
+
+func (c *IMAPClient) Namespace() (*Namespaces, error) {
+	return c.NamespaceContext(context.Background())
+}
+
+func (c *IMAPClient) NamespaceContext(ctx context.Context) (*Namespaces, error) {
+	resp := c.command(ctx, "NAMESPACE")
+	if resp.Error() != nil {
+		return nil, resp.Error()
+	}
+	for _, reply := range resp.Replys() {
+		args, ok := replyArgs(reply, "NAMESPACE")
+		if !ok {
+			continue
+		}
+		fields, err := parseFields(args)
+		if err != nil || len(fields) < 3 {
+			continue
+		}
+		return &Namespaces{
+			Personal: parseNamespaces(fields[0]),
+			Other:    parseNamespaces(fields[1]),
+			Shared:   parseNamespaces(fields[2]),
+		}, nil
+	}
+	return nil, errors.New("Invalid response")
+}
+
+// parseNamespaces reads a list of namespaces, ignoring their extension
+// data.
+func parseNamespaces(field interface{}) []Namespace {
+	var namespaces []Namespace
+	for _, item := range asList(field) {
+		desc := asList(item)
+		if len(desc) < 2 {
+			continue
+		}
+		ns := Namespace{Prefix: asString(desc[0]), Delimiter: asString(desc[1])}
+		if prefix, err := DecodeMailbox(ns.Prefix); err == nil {
+			ns.Prefix = prefix
+		}
+		namespaces = append(namespaces, ns)
+	}
+	return namespaces
+}
+
+func (c *IMAPClient) Subscribe(name string) error {
+	return c.SubscribeContext(context.Background(), name)
+}
+
+func (c *IMAPClient) SubscribeContext(ctx context.Context, name string) error {
+	return c.command(ctx, "SUBSCRIBE", quote(EncodeMailbox(name))).Error()
+}
+
+func (c *IMAPClient) Unsubscribe(name string) error {
+	return c.UnsubscribeContext(context.Background(), name)
+}
+
+func (c *IMAPClient) UnsubscribeContext(ctx context.Context, name string) error {
+	return c.command(ctx, "UNSUBSCRIBE", quote(EncodeMailbox(name))).Error()
+}
+
+func (c *IMAPClient) Lsub(ref, pattern string) ([]*MailboxInfo, error) {
+	return c.LsubContext(context.Background(), ref, pattern)
+}
+
+// LsubContext is like ListContext but only returns subscribed mailboxes.
+func (c *IMAPClient) LsubContext(ctx context.Context, ref, pattern string) ([]*MailboxInfo, error) {
+	resp := c.command(ctx, "LSUB", quote(EncodeMailbox(ref)), quote(EncodeMailbox(pattern)))
+	if resp.Error() != nil {
+		return nil, resp.Error()
+	}
+	return parseMailboxList(resp, "LSUB")
+}
+
+const (
+	StatusMessages    = "MESSAGES"
+	StatusRecent      = "RECENT"
+	StatusUIDNext     = "UIDNEXT"
+	StatusUIDValidity = "UIDVALIDITY"
+	StatusUnseen      = "UNSEEN"
+	// StatusSize needs the STATUS=SIZE extension (RFC 8438).
+	StatusSize = "SIZE"
+	// StatusHighestModSeq needs the CONDSTORE extension (RFC 7162).
+	StatusHighestModSeq = "HIGHESTMODSEQ"
+)
+
+// MailboxStatus describes a mailbox, as returned by Status or by Select
+// and Examine. Fields that were not requested or reported are zero.
+type MailboxStatus struct {
+	Name        string
+	Messages    uint32
+	Recent      uint32
+	Unseen      uint32
+	UIDNext     uint32
+	UIDValidity uint32
+	Size        uint64
+	// HighestModSeq is the highest mod-sequence of the messages, which
+	// changes whenever they do, if the server supports CONDSTORE and the
+	// mailbox has mod-sequences. For the selected mailbox, Mailbox returns
+	// it updated as the server reports new values, so it can be saved as a
+	// sync token after each command.
+	HighestModSeq uint64
+
+	// The remaining fields are only set by Select and Examine.
+	ReadOnly       bool
+	Flags          []string
+	PermanentFlags []string
+	// UnseenSeqNum is the sequence number of the first unseen message.
+	// SELECT does not report the number of unseen messages in Unseen.
+	UnseenSeqNum uint32
+}
+
+func (c *IMAPClient) Status(name string, items ...string) (*MailboxStatus, error) {
+	return c.StatusContext(context.Background(), name, items...)
+}
+
+// StatusContext issues STATUS for the given items, or for all items but
+// StatusSize if none are given, without selecting the mailbox.
+func (c *IMAPClient) StatusContext(ctx context.Context, name string, items ...string) (*MailboxStatus, error) {
+	if len(items) == 0 {
+		items = []string{StatusMessages, StatusRecent, StatusUIDNext, StatusUIDValidity, StatusUnseen}
+	}
+	resp := c.command(ctx, "STATUS", quote(EncodeMailbox(name)), "("+strings.Join(items, " ")+")")
+	if resp.Error() != nil {
+		return nil, resp.Error()
+	}
+	for _, reply := range resp.Replys() {
+		args, ok := replyArgs(reply, "STATUS")
+		if !ok {
+			continue
+		}
+		fields, err := parseFields(args)
+		if err != nil || len(fields) < 2 || !sameMailbox(asString(fields[0]), name) {
+			continue
+		}
+		status := &MailboxStatus{Name: name}
+		if err := status.parse(asList(fields[1])); err != nil {
+			return nil, err
+		}
+		return status, nil
+	}
+	return nil, errors.New("Invalid response")
+}
+
+// sameMailbox reports whether raw, a mailbox name as the server sent it,
+// is name, which may be sent in any case if it is INBOX.
+func sameMailbox(raw, name string) bool {
+	if decoded, err := DecodeMailbox(raw); err == nil {
+		raw = decoded
+	}
+	return raw == name || strings.EqualFold(raw, Inbox) && strings.EqualFold(name, Inbox)
+}
+
+func (status *MailboxStatus) parse(items []interface{}) error {
+	for i := 0; i+1 < len(items); i += 2 {
+		value := asString(items[i+1])
+		n, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			return errors.New("Invalid STATUS value " + value)
+		}
+		switch strings.ToUpper(asString(items[i])) {
+		case StatusMessages:
+			status.Messages = uint32(n)
+		case StatusRecent:
+			status.Recent = uint32(n)
+		case StatusUIDNext:
+			status.UIDNext = uint32(n)
+		case StatusUIDValidity:
+			status.UIDValidity = uint32(n)
+		case StatusUnseen:
+			status.Unseen = uint32(n)
+		case StatusSize:
+			status.Size = n
+		case StatusHighestModSeq:
+			status.HighestModSeq = n
+		}
+	}
+	return nil
+}
+
+// parseSelect reads the untagged responses and response codes of a
+// SELECT or EXAMINE.
+func (status *MailboxStatus) parseSelect(resp *Response) error {
+	for _, reply := range resp.Replys() {
+		origin := reply.Origin()
+		fields := strings.Fields(origin)
+		if len(fields) < 2 {
+			continue
+		}
+		switch strings.ToUpper(fields[0]) {
+		case "FLAGS":
+			list, err := parseFields(origin[len(fields[0]):])
+			if err != nil {
+				return err
+			}
+			status.Flags = flagList(list)
+			continue
+		case "OK":
+			if err := status.parseCode(origin[len(fields[0]):]); err != nil {
+				return err
+			}
+			continue
+		}
+		n, ok := asNumber(fields[0])
+		if !ok {
+			continue
+		}
+		switch strings.ToUpper(fields[1]) {
+		case "EXISTS":
+			status.Messages = n
+		case "RECENT":
+			status.Recent = n
+		}
+	}
+	return status.parseCode(strings.TrimPrefix(resp.Status(), "OK"))
+}
+
+func (status *MailboxStatus) parseCode(text string) error {
+	code, args := responseCode(text)
+	switch code {
+	case "PERMANENTFLAGS":
+		list, err := parseFields(args)
+		if err != nil {
+			return err
+		}
+		status.PermanentFlags = flagList(list)
+	case "UIDVALIDITY":
+		status.UIDValidity, _ = asNumber(args)
+	case "UIDNEXT":
+		status.UIDNext, _ = asNumber(args)
+	case "UNSEEN":
+		status.UnseenSeqNum, _ = asNumber(args)
+	case "HIGHESTMODSEQ":
+		status.HighestModSeq, _ = asNumber64(args)
+	case "NOMODSEQ":
+		status.HighestModSeq = 0
+	case "READ-ONLY":
+		status.ReadOnly = true
+	case "READ-WRITE":
+		status.ReadOnly = false
+	}
+	return nil
+}
+
+// updateModSeq records the [HIGHESTMODSEQ] response codes in resp, which
+// servers send after changes once QRESYNC is enabled, for the selected
+// mailbox. The status is replaced rather than changed, as callers of
+// Mailbox may be reading it.
+func (c *IMAPClient) updateModSeq(resp *Response) {
+	if c.mailbox == nil {
+		return
+	}
+	highest := c.mailbox.HighestModSeq
+	update := func(text string) {
+		if code, args := responseCode(text); code == "HIGHESTMODSEQ" {
+			if n, ok := asNumber64(args); ok && n > highest {
+				highest = n
+			}
+		}
+	}
+	for _, reply := range resp.Replys() {
+		if origin := reply.Origin(); len(origin) > 3 && strings.EqualFold(origin[:3], "OK ") {
+			update(origin[3:])
+		}
+	}
+	if resp.Error() == nil {
+		update(strings.TrimPrefix(resp.Status(), "OK"))
+	}
+	if highest != c.mailbox.HighestModSeq {
+		mailbox := *c.mailbox
+		mailbox.HighestModSeq = highest
+		c.mailbox = &mailbox
+	}
+}
+
+func flagList(fields []interface{}) []string {
+	var flags []string
+	if len(fields) > 0 {
+		flags = []string{}
+		for _, flag := range asList(fields[0]) {
+			flags = append(flags, asString(flag))
+		}
+	}
+	return flags
+}
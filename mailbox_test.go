@@ -0,0 +1,156 @@
+package imap
+
+import (
+	"context"
+	"testing"
+)
+
+// noise are untagged responses unrelated to the command, some of them
+// malformed, which must not make it fail.
+var noise = []string{
+	`* OK [ALERT] Quota at "95%`,
+	`* FLAGS (\Seen \Deleted`,
+	`* CAPABILITY IMAP4rev1 (`,
+	`* LISTX (\Noselect) "/" broken`,
+}
+
+func TestListSkipsOtherReplies(t *testing.T) {
+	c := testClient(t, "* PREAUTH ready", func(s *fakeServer) {
+		tag := s.expect(`LIST "" "*"`)
+		s.write(noise...)
+		s.write(`* LIST (\HasNoChildren) "/" INBOX`, `* LIST (\Noselect) "/" "Gr&APwA3w-e"`, tag+" OK done")
+	})
+	list, err := c.List("", "*")
+	if err != nil || len(list) != 2 || list[1].Name != "Grüße" || !list[1].HasAttr(`\Noselect`) {
+		t.Fatalf("got %+v, %v", list, err)
+	}
+}
+
+func TestStatusSkipsOtherReplies(t *testing.T) {
+	c := testClient(t, "* PREAUTH ready", func(s *fakeServer) {
+		tag := s.expect(`STATUS "INBOX" (MESSAGES UNSEEN)`)
+		s.write(noise...)
+		s.write(`* STATUS INBOX (MESSAGES 17 UNSEEN 3)`, tag+" OK done")
+	})
+	status, err := c.Status("INBOX", StatusMessages, StatusUnseen)
+	if err != nil || status.Messages != 17 || status.Unseen != 3 {
+		t.Fatalf("got %+v, %v", status, err)
+	}
+}
+
+func TestNamespaceSkipsOtherReplies(t *testing.T) {
+	c := testClient(t, "* PREAUTH ready", func(s *fakeServer) {
+		tag := s.expect("NAMESPACE")
+		s.write(noise...)
+		s.write(`* NAMESPACE (("" "/")) NIL (("Shared/" "/"))`, tag+" OK done")
+	})
+	ns, err := c.Namespace()
+	if err != nil || len(ns.Personal) != 1 || ns.Other != nil || ns.Shared[0].Prefix != "Shared/" {
+		t.Fatalf("got %+v, %v", ns, err)
+	}
+}
+
+func TestReconnectClearsDelimiter(t *testing.T) {
+	c := testClient(t, "* PREAUTH ready", func(s *fakeServer) {
+		tag := s.expect(`LIST "" ""`)
+		s.write(`* LIST (\Noselect) "/" ""`, tag+" OK done")
+	})
+	c.redial = func(ctx context.Context) (*IMAPClient, error) {
+		return testClient(t, "* PREAUTH ready", func(s *fakeServer) {
+			tag := s.expect(`LIST "" ""`)
+			s.write(`* LIST (\Noselect) "." ""`, tag+" OK done")
+		}), nil
+	}
+	if delim, err := c.Delimiter(); err != nil || delim != "/" {
+		t.Fatalf("got %q, %v, want %q", delim, err, "/")
+	}
+	if err := c.Reconnect(); err != nil {
+		t.Fatal(err)
+	}
+	if delim, err := c.Delimiter(); err != nil || delim != "." {
+		t.Fatalf("after Reconnect: got %q, %v, want %q", delim, err, ".")
+	}
+}
+
+func TestHighestModSeq(t *testing.T) {
+	c := testClient(t, "* PREAUTH [CAPABILITY IMAP4rev1 CONDSTORE] ready", func(s *fakeServer) {
+		tag := s.expect(`SELECT "A"`)
+		s.write("* 1 EXISTS", "* OK [HIGHESTMODSEQ 5] ok", tag+" OK [READ-WRITE] done")
+		tag = s.expect(`SELECT "B"`)
+		s.write("* 1 EXISTS", "* OK [HIGHESTMODSEQ 10] ok", tag+" OK [READ-WRITE] done")
+		tag = s.expect("NOOP")
+		s.write("* OK [HIGHESTMODSEQ 12] ok", tag+" OK done")
+	})
+	a, err := c.Select("A")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := c.Select("B")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.HighestModSeq != 5 || b.HighestModSeq != 10 {
+		t.Errorf("got %d and %d, want 5 and 10", a.HighestModSeq, b.HighestModSeq)
+	}
+	if err := c.Noop(); err != nil {
+		t.Fatal(err)
+	}
+	if got := c.Mailbox().HighestModSeq; got != 12 || b.HighestModSeq != 10 {
+		t.Errorf("got %d, want 12 with the status from Select left at 10", got)
+	}
+}
+
+func TestCreateAllWildcards(t *testing.T) {
+	c := testClient(t, "* PREAUTH ready", func(s *fakeServer) {
+		tag := s.expect(`LIST "" ""`)
+		s.write(`* LIST (\Noselect) "/" ""`, tag+" OK done")
+		tag = s.expect(`LIST "" "Work"`)
+		s.write(`* LIST () "/" "Work"`, tag+" OK done")
+		// Listing Work/50% would also match Work/500.
+		tag = s.expect(`CREATE "Work/50%"`)
+		s.write(tag + " NO [ALREADYEXISTS] Mailbox exists")
+		tag = s.expect(`CREATE "Work/50%/Q1"`)
+		s.write(tag + " OK done")
+	})
+	if err := c.CreateAll("Work/50%/Q1"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCreateAllExactName(t *testing.T) {
+	c := testClient(t, "* PREAUTH ready", func(s *fakeServer) {
+		tag := s.expect(`LIST "" ""`)
+		s.write(`* LIST (\Noselect) "." ""`, tag+" OK done")
+		tag = s.expect(`LIST "" "A"`)
+		s.write(`* LIST () "." "a"`, tag+" OK done")
+		tag = s.expect(`CREATE "A"`)
+		s.write(tag + " OK done")
+		tag = s.expect(`LIST "" "A.B"`)
+		s.write(tag + " OK done")
+		tag = s.expect(`CREATE "A.B"`)
+		s.write(tag + " NO [CANNOT] Not allowed")
+	})
+	if err := c.CreateAll("A.B"); err == nil {
+		t.Fatal("got no error")
+	}
+}
+
+func TestStatusOtherMailbox(t *testing.T) {
+	c := testClient(t, "* PREAUTH ready", func(s *fakeServer) {
+		tag := s.expect(`STATUS "Gr&APwA3w-e" (MESSAGES)`)
+		s.write(`* STATUS Archive (MESSAGES 900)`, `* STATUS "Gr&APwA3w-e" (MESSAGES 4)`, tag+" OK done")
+		tag = s.expect(`STATUS "inbox" (MESSAGES)`)
+		s.write(`* STATUS INBOX (MESSAGES 2)`, tag+" OK done")
+		tag = s.expect(`STATUS "Sent" (MESSAGES)`)
+		s.write(`* STATUS Archive (MESSAGES 900)`, tag+" OK done")
+	})
+	if status, err := c.Status("Grüße", StatusMessages); err != nil || status.Messages != 4 {
+		t.Errorf("got %+v, %v", status, err)
+	}
+	if status, err := c.Status("inbox", StatusMessages); err != nil || status.Messages != 2 {
+		t.Errorf("INBOX: got %+v, %v", status, err)
+	}
+	if status, err := c.Status("Sent", StatusMessages); err == nil {
+		t.Errorf("Sent: got %+v", status)
+	}
+}
@@ -0,0 +1,553 @@
+package imap
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/mail"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DateTimeLayout is the time layout of IMAP date-time values such as
+// INTERNALDATE.
+const DateTimeLayout = "_2-Jan-2006 15:04:05 -0700"
+
+// DateLayout is the time layout of IMAP dates, as used by the SEARCH
+// criteria BEFORE, ON, SINCE and their SENT variants. Servers compare them
+// with the date of a message in its own time zone.
+const DateLayout = "2-Jan-2006"
+
+// AppendUID is the data of an APPENDUID response code (RFC 4315): the
+// appended message got UID in a mailbox whose UIDVALIDITY is UIDValidity.
+type AppendUID struct {
+	UIDValidity uint32
+	UID         UID
+}
+
+func (c *IMAPClient) Append(mailbox string, flags []string, date time.Time, msg Literal) (*AppendUID, error) {
+	return c.AppendContext(context.Background(), mailbox, flags, date, msg)
+}
+
+// AppendContext uploads msg, a complete RFC 5322 message with CRLF line
+// endings, to the end of mailbox. The message is streamed once the server
+// accepts the literal. flags, if any, are set on the new message, and a
+// non-zero date becomes its internal date instead of the current time.
+// Flags are checked as in Store, against the PERMANENTFLAGS of mailbox
+// if it is selected. The returned AppendUID is nil unless the server
+// supports UIDPLUS.
+func (c *IMAPClient) AppendContext(ctx context.Context, mailbox string, flags []string, date time.Time, msg Literal) (*AppendUID, error) {
+	selected := c.Mailbox()
+	if err := c.checkKeywords(flags, selected != nil && selected.Name == mailbox); err != nil {
+		return nil, err
+	}
+	args := []interface{}{"APPEND", quote(EncodeMailbox(mailbox))}
+	if len(flags) > 0 {
+		args = append(args, "("+strings.Join(flags, " ")+")")
+	}
+	if !date.IsZero() {
+		args = append(args, `"`+date.Format(DateTimeLayout)+`"`)
+	}
+	args = append(args, msg)
+	resp := c.command(ctx, args...)
+	if resp.Error() != nil {
+		return nil, resp.Error()
+	}
+	return parseAppendUID(strings.TrimPrefix(resp.Status(), "OK")), nil
+}
+
+func parseAppendUID(text string) *AppendUID {
+	code, args := responseCode(text)
+	fields := strings.Fields(args)
+	if code != "APPENDUID" || len(fields) != 2 {
+		return nil
+	}
+	validity, ok := asNumber(fields[0])
+	uid, ok2 := asNumber(fields[1])
+	if !ok || !ok2 {
+		return nil
+	}
+	return &AppendUID{UIDValidity: validity, UID: UID(uid)}
+}
+
+func (c *IMAPClient) Expunge() ([]uint32, error) {
+	return c.ExpungeContext(context.Background())
+}
+
+// ExpungeContext permanently removes the messages marked \Deleted from the
+// selected mailbox. It returns the sequence numbers the server reported as
+// expunged, in order: each one is relative to the mailbox after the
+// previous one was removed. Once QRESYNC is enabled, servers report UIDs
+// with VANISHED instead, and none are returned.
+func (c *IMAPClient) ExpungeContext(ctx context.Context) ([]uint32, error) {
+	if c.ReadOnly() {
+		return nil, ErrReadOnly
+	}
+	resp := c.command(ctx, "EXPUNGE")
+	if resp.Error() != nil {
+		return nil, resp.Error()
+	}
+	return expunged(resp), nil
+}
+
+func (c *IMAPClient) UIDExpunge(set SeqSet) ([]uint32, error) {
+	return c.UIDExpungeContext(context.Background(), set)
+}
+
+// UIDExpungeContext is like ExpungeContext but only removes the messages
+// marked \Deleted whose UIDs are in set, leaving those other clients
+// marked alone. It needs the UIDPLUS extension (RFC 4315).
+func (c *IMAPClient) UIDExpungeContext(ctx context.Context, set SeqSet) ([]uint32, error) {
+	if c.ReadOnly() {
+		return nil, ErrReadOnly
+	}
+	resp := c.command(ctx, "UID EXPUNGE", set)
+	if resp.Error() != nil {
+		return nil, resp.Error()
+	}
+	return expunged(resp), nil
+}
+
+// expunged returns the sequence numbers of the untagged EXPUNGE responses
+// in resp.
+func expunged(resp *Response) []uint32 {
+	var seqs []uint32
+	for _, reply := range resp.Replys() {
+		fields := strings.Fields(reply.Origin())
+		if len(fields) != 2 || !strings.EqualFold(fields[1], "EXPUNGE") {
+			continue
+		}
+		if n, ok := asNumber(fields[0]); ok {
+			seqs = append(seqs, n)
+		}
+	}
+	return seqs
+}
+
+// CopyUID is the data of a COPYUID response code (RFC 4315): the messages
+// with the UIDs in Source were copied to the messages with the UIDs in
+// Dest, in the same order, in a mailbox whose UIDVALIDITY is UIDValidity.
+type CopyUID struct {
+	UIDValidity uint32
+	Source      string
+	Dest        string
+}
+
+func (c *IMAPClient) Copy(set SeqSet, mailbox string) (*CopyUID, error) {
+	return c.CopyContext(context.Background(), set, mailbox)
+}
+
+// CopyContext copies the messages in set to mailbox. The returned
+// CopyUID is nil unless the server supports UIDPLUS.
+func (c *IMAPClient) CopyContext(ctx context.Context, set SeqSet, mailbox string) (*CopyUID, error) {
+	return c.copy(ctx, "COPY", set, mailbox)
+}
+
+// UIDCopy is like Copy but takes UIDs.
+func (c *IMAPClient) UIDCopy(set SeqSet, mailbox string) (*CopyUID, error) {
+	return c.UIDCopyContext(context.Background(), set, mailbox)
+}
+
+func (c *IMAPClient) UIDCopyContext(ctx context.Context, set SeqSet, mailbox string) (*CopyUID, error) {
+	return c.copy(ctx, "UID COPY", set, mailbox)
+}
+
+func (c *IMAPClient) copy(ctx context.Context, cmd string, set SeqSet, mailbox string) (*CopyUID, error) {
+	resp := c.command(ctx, cmd, set, quote(EncodeMailbox(mailbox)))
+	if resp.Error() != nil {
+		return nil, resp.Error()
+	}
+	return parseCopyUID(strings.TrimPrefix(resp.Status(), "OK")), nil
+}
+
+func parseCopyUID(text string) *CopyUID {
+	code, args := responseCode(text)
+	fields := strings.Fields(args)
+	if code != "COPYUID" || len(fields) != 3 {
+		return nil
+	}
+	validity, ok := asNumber(fields[0])
+	if !ok {
+		return nil
+	}
+	return &CopyUID{UIDValidity: validity, Source: fields[1], Dest: fields[2]}
+}
+
+func (c *IMAPClient) Move(set SeqSet, mailbox string) (*CopyUID, error) {
+	return c.MoveContext(context.Background(), set, mailbox)
+}
+
+// ErrMoveNotExpunged is returned by Move when the server has neither MOVE
+// nor UIDPLUS: the messages were copied and marked \Deleted, but are left
+// for the caller to expunge, since EXPUNGE would also remove any other
+// message marked \Deleted.
+var ErrMoveNotExpunged = errors.New("Server lacks MOVE and UIDPLUS, messages were copied and marked \\Deleted but not expunged")
+
+// MoveContext moves the messages in set to mailbox. Without the MOVE
+// extension (RFC 6851) it copies them, marks them \Deleted and expunges
+// only them with UID EXPUNGE, which needs UIDPLUS; without it, it returns
+// ErrMoveNotExpunged.
+func (c *IMAPClient) MoveContext(ctx context.Context, set SeqSet, mailbox string) (*CopyUID, error) {
+	return c.move(ctx, false, set, mailbox)
+}
+
+// UIDMove is like Move but takes UIDs.
+func (c *IMAPClient) UIDMove(set SeqSet, mailbox string) (*CopyUID, error) {
+	return c.UIDMoveContext(context.Background(), set, mailbox)
+}
+
+// UIDMoveContext moves the messages with the UIDs in set to mailbox like
+// MoveContext. Its fallback without MOVE likewise needs UIDPLUS to expunge
+// them, and otherwise returns ErrMoveNotExpunged.
+func (c *IMAPClient) UIDMoveContext(ctx context.Context, set SeqSet, mailbox string) (*CopyUID, error) {
+	return c.move(ctx, true, set, mailbox)
+}
+
+func (c *IMAPClient) move(ctx context.Context, uid bool, set SeqSet, mailbox string) (*CopyUID, error) {
+	prefix := ""
+	if uid {
+		prefix = "UID "
+	}
+	if c.ReadOnly() {
+		return nil, ErrReadOnly
+	}
+	caps, err := c.capabilities(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if caps.Has("MOVE") {
+		resp := c.command(ctx, prefix+"MOVE", set, quote(EncodeMailbox(mailbox)))
+		if resp.Error() != nil {
+			return nil, resp.Error()
+		}
+		for _, reply := range resp.Replys() {
+			if origin := reply.Origin(); len(origin) > 2 && strings.EqualFold(origin[:2], "OK") {
+				if uid := parseCopyUID(origin[2:]); uid != nil {
+					return uid, nil
+				}
+			}
+		}
+		return parseCopyUID(strings.TrimPrefix(resp.Status(), "OK")), nil
+	}
+
+	// The UIDs to expunge are looked up before the sequence numbers in
+	// set may change.
+	uids := set
+	if !uid && caps.Has("UIDPLUS") {
+		found, err := c.UIDSearchContext(ctx, set)
+		if err != nil {
+			return nil, err
+		}
+		uids = NewUIDSet(found...)
+	}
+	copied, err := c.copy(ctx, prefix+"COPY", set, mailbox)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.command(ctx, prefix+"STORE", set, "+FLAGS.SILENT", `(\Deleted)`).Error(); err != nil {
+		return copied, err
+	}
+	if !caps.Has("UIDPLUS") {
+		return copied, ErrMoveNotExpunged
+	}
+	if uids.Empty() {
+		return copied, nil
+	}
+	_, err = c.UIDExpungeContext(ctx, uids)
+	return copied, err
+}
+
+// StoreOp says how Store changes the flags of messages.
+type StoreOp string
+
+const (
+	SetFlags    StoreOp = "FLAGS"
+	AddFlags    StoreOp = "+FLAGS"
+	RemoveFlags StoreOp = "-FLAGS"
+)
+
+func (c *IMAPClient) Store(set SeqSet, op StoreOp, silent bool, flags ...string) (map[uint32][]string, error) {
+	return c.StoreContext(context.Background(), set, op, silent, flags...)
+}
+
+// StoreContext replaces, adds or removes flags of the messages in set. It
+// returns the resulting flags by sequence number, as the server reports
+// them unless silent is true.
+func (c *IMAPClient) StoreContext(ctx context.Context, set SeqSet, op StoreOp, silent bool, flags ...string) (map[uint32][]string, error) {
+	result, _, err := c.store(ctx, "STORE", set, 0, op, silent, flags)
+	return result, err
+}
+
+// UIDStore is like Store but takes UIDs, and the result is keyed by UID.
+func (c *IMAPClient) UIDStore(set SeqSet, op StoreOp, silent bool, flags ...string) (map[uint32][]string, error) {
+	return c.UIDStoreContext(context.Background(), set, op, silent, flags...)
+}
+
+func (c *IMAPClient) UIDStoreContext(ctx context.Context, set SeqSet, op StoreOp, silent bool, flags ...string) (map[uint32][]string, error) {
+	result, _, err := c.store(ctx, "UID STORE", set, 0, op, silent, flags)
+	return result, err
+}
+
+func (c *IMAPClient) StoreUnchangedSince(set SeqSet, modSeq uint64, op StoreOp, silent bool, flags ...string) (map[uint32][]string, SeqSet, error) {
+	return c.StoreUnchangedSinceContext(context.Background(), set, modSeq, op, silent, flags...)
+}
+
+// StoreUnchangedSinceContext is like StoreContext but only changes the
+// messages whose mod-sequence is not greater than modSeq, that nobody
+// changed since the client last saw them (RFC 7162 CONDSTORE). It also
+// returns the sequence numbers of the messages left alone, whose flags the
+// client should fetch again before retrying.
+func (c *IMAPClient) StoreUnchangedSinceContext(ctx context.Context, set SeqSet, modSeq uint64, op StoreOp, silent bool, flags ...string) (map[uint32][]string, SeqSet, error) {
+	return c.store(ctx, "STORE", set, modSeq, op, silent, flags)
+}
+
+// UIDStoreUnchangedSince is like StoreUnchangedSince but takes and
+// returns UIDs.
+func (c *IMAPClient) UIDStoreUnchangedSince(set SeqSet, modSeq uint64, op StoreOp, silent bool, flags ...string) (map[uint32][]string, SeqSet, error) {
+	return c.UIDStoreUnchangedSinceContext(context.Background(), set, modSeq, op, silent, flags...)
+}
+
+func (c *IMAPClient) UIDStoreUnchangedSinceContext(ctx context.Context, set SeqSet, modSeq uint64, op StoreOp, silent bool, flags ...string) (map[uint32][]string, SeqSet, error) {
+	return c.store(ctx, "UID STORE", set, modSeq, op, silent, flags)
+}
+
+// store issues STORE, with the UNCHANGEDSINCE modifier unless
+// unchangedSince is zero, and returns the [MODIFIED] set in that case.
+func (c *IMAPClient) store(ctx context.Context, cmd string, set SeqSet, unchangedSince uint64, op StoreOp, silent bool, flags []string) (map[uint32][]string, SeqSet, error) {
+	var modified SeqSet
+	if c.ReadOnly() {
+		return nil, modified, ErrReadOnly
+	}
+	if err := c.checkKeywords(flags, op != RemoveFlags); err != nil {
+		return nil, modified, err
+	}
+	item := string(op)
+	if silent {
+		item += ".SILENT"
+	}
+	args := []interface{}{cmd, set}
+	if unchangedSince > 0 {
+		args = append(args, "(UNCHANGEDSINCE "+strconv.FormatUint(unchangedSince, 10)+")")
+	}
+	resp := c.command(ctx, append(args, item, "("+strings.Join(flags, " ")+")")...)
+	if resp.Error() != nil {
+		return nil, modified, resp.Error()
+	}
+	if code, args := responseCode(strings.TrimPrefix(resp.Status(), "OK")); code == "MODIFIED" {
+		var err error
+		if modified, err = ParseSeqSet(args); err != nil {
+			return nil, modified, err
+		}
+	}
+	var result map[uint32][]string
+	for _, reply := range resp.Replys() {
+		seq, items, ok := fetchItems(reply)
+		if !ok {
+			continue
+		}
+		id, ok := seq, true
+		if cmd == "UID STORE" {
+			id, ok = asNumber(fetchItem(items, "UID"))
+		}
+		value := fetchItem(items, "FLAGS")
+		if !ok || value == nil {
+			continue
+		}
+		if result == nil {
+			result = make(map[uint32][]string)
+		}
+		result[id] = flagList([]interface{}{value})
+	}
+	return result, modified, nil
+}
+
+// checkKeywords reports an error for any flag in flags that is not an
+// atom, after the backslash of a system flag, or is \Recent, which only the
+// server sets, and, if permanent is set, for any keyword, that is a flag
+// not starting with a backslash, that the selected mailbox's
+// PERMANENTFLAGS neither lists nor allows with \*.
+func (c *IMAPClient) checkKeywords(flags []string, permanent bool) error {
+	for _, flag := range flags {
+		if !isAtom(strings.TrimPrefix(flag, "\\")) {
+			return errors.New("Invalid flag " + strconv.Quote(flag))
+		}
+		if strings.EqualFold(flag, Recent) {
+			return errors.New("The \\Recent flag cannot be changed by clients")
+		}
+		if strings.HasPrefix(flag, "\\") || !permanent {
+			continue
+		}
+		mailbox := c.Mailbox()
+		if mailbox == nil || mailbox.PermanentFlags == nil {
+			continue
+		}
+		permitted := false
+		for _, f := range mailbox.PermanentFlags {
+			if f == AnyKeyword || strings.EqualFold(f, flag) {
+				permitted = true
+				break
+			}
+		}
+		if !permitted {
+			return errors.New("Server does not permit the keyword " + flag + " in this mailbox")
+		}
+	}
+	return nil
+}
+
+// fetchItems parses an untagged FETCH response into the sequence number
+// and the list of data item names and values.
+func fetchItems(reply reply) (uint32, []interface{}, bool) {
+	fields, err := parseFields(reply.Origin())
+	if err != nil || len(fields) < 3 || !strings.EqualFold(asString(fields[1]), "FETCH") {
+		return 0, nil, false
+	}
+	seq, ok := asNumber(fields[0])
+	return seq, asList(fields[2]), ok
+}
+
+// fetchItem returns the value of the named data item in items, or nil.
+func fetchItem(items []interface{}, name string) interface{} {
+	for i := 0; i+1 < len(items); i += 2 {
+		if strings.EqualFold(asString(items[i]), name) {
+			return items[i+1]
+		}
+	}
+	return nil
+}
+
+// Message is a message in the selected mailbox as listed by Messages. It
+// holds the data needed to show it in a list; its methods fetch the rest
+// on demand, without setting \Seen, and cache what they fetched.
+type Message struct {
+	UID          UID
+	Flags        []string
+	InternalDate time.Time
+	Size         uint32
+	Envelope     *Envelope
+
+	c             *IMAPClient
+	header        mail.Header
+	bodyStructure *BodyStructure
+}
+
+func (c *IMAPClient) Messages(set SeqSet) ([]*Message, error) {
+	return c.MessagesContext(context.Background(), set)
+}
+
+// MessagesContext lists the messages whose UIDs are in set, in UID order,
+// fetching their flags, internal date, size and envelope in one command.
+func (c *IMAPClient) MessagesContext(ctx context.Context, set SeqSet) ([]*Message, error) {
+	results, err := c.UIDFetchMessagesContext(ctx, set, "UID", "FLAGS", "INTERNALDATE", "RFC822.SIZE", "ENVELOPE")
+	if err != nil {
+		return nil, err
+	}
+	msgs := make([]*Message, 0, len(results))
+	for _, result := range results {
+		msgs = append(msgs, &Message{
+			UID:          result.UID,
+			Flags:        result.Flags,
+			InternalDate: result.InternalDate,
+			Size:         result.Size,
+			Envelope:     result.Envelope,
+			c:            c,
+		})
+	}
+	sort.Slice(msgs, func(i, j int) bool { return msgs[i].UID < msgs[j].UID })
+	return msgs, nil
+}
+
+func (m *Message) Header() (mail.Header, error) {
+	return m.HeaderContext(context.Background())
+}
+
+// HeaderContext returns the full header of the message.
+func (m *Message) HeaderContext(ctx context.Context) (mail.Header, error) {
+	if m.header != nil {
+		return m.header, nil
+	}
+	section := &BodySection{Specifier: SectionHeader, Peek: true}
+	results, err := m.c.UIDFetchMessagesContext(ctx, NewUIDSet(m.UID), section.FetchItem())
+	if err != nil {
+		return nil, err
+	}
+	result, ok := results[uint32(m.UID)]
+	if !ok {
+		return nil, errors.New("No such message " + strconv.FormatUint(uint64(m.UID), 10))
+	}
+	data, _ := result.Body(section)
+	if m.header, err = parseHeader(data); err != nil {
+		return nil, err
+	}
+	return m.header, nil
+}
+
+func (m *Message) Body() (*mail.Message, error) {
+	return m.BodyContext(context.Background())
+}
+
+// BodyContext fetches the whole message. It is not cached.
+func (m *Message) BodyContext(ctx context.Context) (*mail.Message, error) {
+	return m.c.UIDGetMessageContext(ctx, strconv.FormatUint(uint64(m.UID), 10))
+}
+
+func (m *Message) BodyStructure() (*BodyStructure, error) {
+	return m.BodyStructureContext(context.Background())
+}
+
+// BodyStructureContext returns the MIME structure of the message.
+func (m *Message) BodyStructureContext(ctx context.Context) (*BodyStructure, error) {
+	if m.bodyStructure != nil {
+		return m.bodyStructure, nil
+	}
+	bs, err := m.c.bodyStructure(ctx, m.UID)
+	if err != nil {
+		return nil, err
+	}
+	m.bodyStructure = bs
+	return bs, nil
+}
+
+func (m *Message) Part(number string) (*Part, error) {
+	return m.PartContext(context.Background(), number)
+}
+
+// PartContext fetches the leaf part with the given number, as in "1.2",
+// with its transfer encoding removed. Its Body stays valid.
+func (m *Message) PartContext(ctx context.Context, number string) (*Part, error) {
+	bs, err := m.BodyStructureContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	part := partByNumber(bs, number)
+	if part == nil {
+		return nil, errors.New("No such part " + number)
+	}
+	data, err := m.c.fetchPart(ctx, m.UID, number, part)
+	if err != nil {
+		return nil, err
+	}
+	return &Part{
+		Number:    number,
+		MediaType: part.MediaType(),
+		Params:    part.Params,
+		Encoding:  part.Encoding,
+		Body:      bytes.NewReader(data),
+	}, nil
+}
+
+func (m *Message) Attachments() ([]*Attachment, error) {
+	return m.AttachmentsContext(context.Background())
+}
+
+// AttachmentsContext lists the attachments of the message without their
+// content, which Part fetches.
+func (m *Message) AttachmentsContext(ctx context.Context) ([]*Attachment, error) {
+	bs, err := m.BodyStructureContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return bs.Attachments(), nil
+}
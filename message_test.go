@@ -0,0 +1,51 @@
+package imap
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMoveFallback(t *testing.T) {
+	c := testClient(t, "* OK [CAPABILITY IMAP4rev1 UIDPLUS] ready", func(s *fakeServer) {
+		tag := s.expect("UID SEARCH 2:3")
+		s.write("* SEARCH 12 13", tag+" OK done")
+		tag = s.expect(`COPY 2:3 "Archive"`)
+		s.write(tag + " OK [COPYUID 7 12:13 1:2] done")
+		tag = s.expect(`STORE 2:3 +FLAGS.SILENT (\Deleted)`)
+		s.write(tag + " OK done")
+		tag = s.expect("UID EXPUNGE 12:13")
+		s.write("* 2 EXPUNGE", "* 2 EXPUNGE", tag+" OK done")
+	})
+	copied, err := c.Move(NewSeqSet(2, 3), "Archive")
+	if err != nil || copied == nil || copied.Dest != "1:2" {
+		t.Fatalf("got %+v, %v", copied, err)
+	}
+}
+
+func TestMoveFallbackWithoutUIDPlus(t *testing.T) {
+	c := testClient(t, "* OK [CAPABILITY IMAP4rev1] ready", func(s *fakeServer) {
+		tag := s.expect(`UID COPY 12 "Archive"`)
+		s.write(tag + " OK done")
+		tag = s.expect(`UID STORE 12 +FLAGS.SILENT (\Deleted)`)
+		s.write(tag + " OK done")
+	})
+	if _, err := c.UIDMove(NewUIDSet(12), "Archive"); err != ErrMoveNotExpunged {
+		t.Fatalf("got %v, want ErrMoveNotExpunged", err)
+	}
+}
+
+func TestStoreRecent(t *testing.T) {
+	c := testClient(t, "* PREAUTH ready", func(s *fakeServer) {
+		s.expectNothing()
+	})
+	for _, op := range []StoreOp{SetFlags, AddFlags, RemoveFlags} {
+		if _, err := c.Store(NewSeqSet(1), op, true, Seen, `\recent`); err == nil {
+			t.Errorf("%s: got no error", op)
+		}
+	}
+	if _, err := c.Append("INBOX", []string{Recent}, time.Time{}, strings.NewReader("")); err == nil {
+		t.Error("Append: got no error")
+	}
+	c.Close()
+}
@@ -0,0 +1,198 @@
+package imap
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// parser reads the data of an untagged response, as kept in a reply's
+// origin, into fields. Atoms, quoted strings and literals become strings,
+// NIL becomes nil and parenthesized lists become []interface{}.
+type parser struct {
+	s string
+	i int
+}
+
+func parseFields(s string) ([]interface{}, error) {
+	p := &parser{s: s}
+	fields, err := p.fields()
+	if err != nil {
+		return nil, err
+	}
+	if p.i < len(p.s) {
+		return nil, errors.New("Parse response error, unexpected ) at " + strconv.Itoa(p.i))
+	}
+	return fields, nil
+}
+
+func (p *parser) fields() ([]interface{}, error) {
+	var fields []interface{}
+	for {
+		for p.i < len(p.s) && p.s[p.i] == ' ' {
+			p.i++
+		}
+		if p.i == len(p.s) || p.s[p.i] == ')' {
+			return fields, nil
+		}
+		field, err := p.field()
+		if err != nil {
+			return nil, err
+		}
+		fields = append(fields, field)
+	}
+}
+
+func (p *parser) field() (interface{}, error) {
+	switch p.s[p.i] {
+	case '(':
+		p.i++
+		list, err := p.fields()
+		if err != nil {
+			return nil, err
+		}
+		if p.i == len(p.s) {
+			return nil, errors.New("Parse response error, missing )")
+		}
+		p.i++
+		if list == nil {
+			list = []interface{}{}
+		}
+		return list, nil
+	case '"':
+		return p.quoted()
+	case '{':
+		return p.literal()
+	case '~':
+		if p.i+1 < len(p.s) && p.s[p.i+1] == '{' {
+			p.i++
+			return p.literal()
+		}
+	}
+	return p.atom()
+}
+
+func (p *parser) quoted() (interface{}, error) {
+	var b strings.Builder
+	for p.i++; p.i < len(p.s); p.i++ {
+		switch c := p.s[p.i]; c {
+		case '\\':
+			p.i++
+			if p.i < len(p.s) {
+				b.WriteByte(p.s[p.i])
+			}
+		case '"':
+			p.i++
+			return b.String(), nil
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return nil, errors.New("Parse response error, unterminated quoted string")
+}
+
+func (p *parser) literal() (interface{}, error) {
+	end := strings.IndexByte(p.s[p.i:], '}')
+	if end < 0 {
+		return nil, errors.New("Parse response error, invalid literal")
+	}
+	size, err := strconv.Atoi(strings.TrimSuffix(p.s[p.i+1:p.i+end], "+"))
+	start := p.i + end + 3
+	if err != nil || size < 0 || start+size > len(p.s) {
+		return nil, errors.New("Parse response error, invalid literal")
+	}
+	p.i = start + size
+	return p.s[start:p.i], nil
+}
+
+// atom reads an atom, including any [section] and <partial> suffix of a
+// FETCH data item name such as BODY[HEADER.FIELDS (FROM)]<0>.
+func (p *parser) atom() (interface{}, error) {
+	start, depth := p.i, 0
+	for ; p.i < len(p.s); p.i++ {
+		c := p.s[p.i]
+		if c == '[' {
+			depth++
+		} else if c == ']' && depth > 0 {
+			depth--
+		} else if depth == 0 && (c == ' ' || c == '(' || c == ')') {
+			break
+		}
+	}
+	atom := p.s[start:p.i]
+	if atom == "" {
+		return nil, errors.New("Parse response error, unexpected " + string(p.s[p.i]))
+	}
+	if strings.EqualFold(atom, "NIL") {
+		return nil, nil
+	}
+	return atom, nil
+}
+
+// replyArgs returns what follows the name of reply if it is an untagged
+// response called name, as in replyArgs(r, "LIST") for "LIST (\Noselect)
+// "/" foo".
+func replyArgs(r reply, name string) (string, bool) {
+	origin := r.Origin()
+	if len(origin) < len(name) || !strings.EqualFold(origin[:len(name)], name) {
+		return "", false
+	}
+	if len(origin) > len(name) && origin[len(name)] != ' ' {
+		return "", false
+	}
+	return origin[len(name):], true
+}
+
+func asString(field interface{}) string {
+	s, _ := field.(string)
+	return s
+}
+
+func asList(field interface{}) []interface{} {
+	list, _ := field.([]interface{})
+	return list
+}
+
+func asNumber(field interface{}) (uint32, bool) {
+	n, err := strconv.ParseUint(asString(field), 10, 32)
+	return uint32(n), err == nil
+}
+
+func asNumber64(field interface{}) (uint64, bool) {
+	n, err := strconv.ParseUint(asString(field), 10, 64)
+	return n, err == nil
+}
+
+// isCriterion reports whether s can be sent as a bare search criterion: an
+// atom or a sequence set, which may open or close parentheses.
+func isCriterion(s string) bool {
+	s = strings.TrimRight(strings.TrimLeft(s, "("), ")")
+	if _, err := ParseSeqSet(s); err == nil {
+		return true
+	}
+	return isAtom(s)
+}
+
+// checkCriteria reports an error for any string in criteria that is not a
+// valid criterion, such as a search term that should have been Quoted.
+func checkCriteria(criteria []interface{}) error {
+	for _, arg := range criteria {
+		if s, ok := arg.(string); ok && !isCriterion(s) {
+			return errors.New("Invalid search criterion " + strconv.Quote(s) + ", use Quoted for search terms")
+		}
+	}
+	return nil
+}
+
+// isAtom reports whether s can be sent as an atom.
+func isAtom(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if b := s[i]; b <= ' ' || b >= 0x7f || strings.IndexByte("(){%*\"\\]", b) >= 0 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,64 @@
+package imap
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseFields(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []interface{}
+	}{
+		{"", nil},
+		{"FLAGS (\\Seen \\Answered)", []interface{}{"FLAGS", []interface{}{"\\Seen", "\\Answered"}}},
+		{`"a \"q\" \\ b" NIL nil`, []interface{}{`a "q" \ b`, nil, nil}},
+		{"() (())", []interface{}{[]interface{}{}, []interface{}{[]interface{}{}}}},
+		{"BODY[HEADER.FIELDS (FROM TO)]<0> {5}\r\nhello", []interface{}{"BODY[HEADER.FIELDS (FROM TO)]<0>", "hello"}},
+		{"X ~{3}\r\na\x00b Y", []interface{}{"X", "a\x00b", "Y"}},
+		{"X {2+}\r\nab", []interface{}{"X", "ab"}},
+		{"1 FETCH (UID 7 FLAGS ())", []interface{}{"1", "FETCH", []interface{}{"UID", "7", "FLAGS", []interface{}{}}}},
+	}
+	for _, test := range tests {
+		got, err := parseFields(test.in)
+		if err != nil || !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%q: got %#v, %v", test.in, got, err)
+		}
+	}
+}
+
+func TestParseFieldsErrors(t *testing.T) {
+	for _, in := range []string{
+		"(a b",
+		"a)",
+		`"unterminated`,
+		"{5}\r\nabc",
+		"{x}\r\nabc",
+		"{3",
+	} {
+		if got, err := parseFields(in); err == nil {
+			t.Errorf("%q: got %#v, want an error", in, got)
+		}
+	}
+}
+
+func TestReplyArgs(t *testing.T) {
+	tests := []struct {
+		origin, name string
+		args         string
+		ok           bool
+	}{
+		{"LIST () \"/\" INBOX", "LIST", " () \"/\" INBOX", true},
+		{"list () \"/\" INBOX", "LIST", " () \"/\" INBOX", true},
+		{"SEARCH", "SEARCH", "", true},
+		{"SEARCHRES 1", "SEARCH", "", false},
+		{"ESEARCH (TAG \"a1\")", "SEARCH", "", false},
+		{"LIS", "LIST", "", false},
+	}
+	for _, test := range tests {
+		args, ok := replyArgs(reply{origin: []byte(test.origin)}, test.name)
+		if args != test.args || ok != test.ok {
+			t.Errorf("%q %s: got %q, %v", test.origin, test.name, args, ok)
+		}
+	}
+}
@@ -0,0 +1,253 @@
+package imap
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"strconv"
+	"strings"
+)
+
+// Part is a leaf part of a MIME message, such as a text body or an
+// attachment.
+type Part struct {
+	// Number is the IMAP part number, as in "1.2". A message that is not
+	// multipart consists of part "1".
+	Number string
+	// MediaType is the lower cased type and subtype, as in "text/plain".
+	MediaType string
+	Params    map[string]string
+	// Header is the header of the part, or nil for parts found with
+	// WalkParts, which only knows their BODYSTRUCTURE.
+	Header mail.Header
+	// Encoding is the lower cased Content-Transfer-Encoding.
+	Encoding string
+	// Body reads the content with its transfer encoding removed. It is
+	// only valid during the call that yields the part.
+	Body io.Reader
+}
+
+// WalkMessage calls fn for each leaf part of msg, in order, descending
+// into multipart parts. Walking stops at the first error fn returns.
+func WalkMessage(msg *mail.Message, fn func(p *Part) error) error {
+	return walkEntity(msg.Header, msg.Body, "", fn)
+}
+
+func walkEntity(header mail.Header, body io.Reader, number string, fn func(p *Part) error) error {
+	mediaType, params, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil {
+		mediaType, params = "text/plain", map[string]string{}
+	}
+	if strings.HasPrefix(mediaType, "multipart/") && params["boundary"] != "" {
+		r := multipart.NewReader(body, params["boundary"])
+		for i := 1; ; i++ {
+			p, err := r.NextRawPart()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if err := walkEntity(mail.Header(p.Header), p, childNumber(number, i), fn); err != nil {
+				return err
+			}
+		}
+	}
+	if number == "" {
+		number = "1"
+	}
+	encoding := strings.ToLower(strings.TrimSpace(header.Get("Content-Transfer-Encoding")))
+	return fn(&Part{
+		Number:    number,
+		MediaType: mediaType,
+		Params:    params,
+		Header:    header,
+		Encoding:  encoding,
+		Body:      DecodeTransferEncoding(encoding, body),
+	})
+}
+
+func childNumber(parent string, i int) string {
+	if parent == "" {
+		return strconv.Itoa(i)
+	}
+	return parent + "." + strconv.Itoa(i)
+}
+
+// DecodeTransferEncoding returns a reader that removes the base64 or
+// quoted-printable Content-Transfer-Encoding named by encoding from r as
+// it is read. Other encodings, such as 7bit, 8bit and binary, need no
+// decoding and r is returned as is.
+func DecodeTransferEncoding(encoding string, r io.Reader) io.Reader {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "base64":
+		return base64.NewDecoder(base64.StdEncoding, &base64Cleaner{r: r})
+	case "quoted-printable":
+		return quotedprintable.NewReader(r)
+	}
+	return r
+}
+
+// DecodeWriter returns a writer that removes the transfer encoding from
+// what is written to it and writes the result to w, so a part streamed
+// with FetchTo arrives decoded:
+//
+//	dw := imap.DecodeWriter(part.Encoding, f)
+//	_, err := c.UIDFetchTo(uid, "BODY.PEEK[2]", dw)
+//	if cerr := dw.Close(); err == nil {
+//		err = cerr
+//	}
+//
+// Close must be called once writing is done; it flushes the decoder and
+// reports any decoding error.
+func DecodeWriter(encoding string, w io.Writer) io.WriteCloser {
+	pr, pw := io.Pipe()
+	dw := &decodeWriter{pw: pw, done: make(chan error, 1)}
+	go func() {
+		_, err := io.Copy(w, DecodeTransferEncoding(encoding, pr))
+		pr.CloseWithError(err)
+		dw.done <- err
+	}()
+	return dw
+}
+
+type decodeWriter struct {
+	pw     *io.PipeWriter
+	done   chan error
+	closed bool
+	err    error
+}
+
+func (dw *decodeWriter) Write(p []byte) (int, error) {
+	return dw.pw.Write(p)
+}
+
+func (dw *decodeWriter) Close() error {
+	if !dw.closed {
+		dw.closed = true
+		dw.pw.Close()
+		dw.err = <-dw.done
+	}
+	return dw.err
+}
+
+// base64Cleaner drops whitespace from base64 bodies: base64.NewDecoder
+// skips line breaks but not the trailing spaces some mailers add.
+type base64Cleaner struct {
+	r io.Reader
+}
+
+func (c *base64Cleaner) Read(p []byte) (int, error) {
+	for {
+		n, err := c.r.Read(p)
+		j := 0
+		for _, b := range p[:n] {
+			if b != '\r' && b != '\n' && b != ' ' && b != '\t' {
+				p[j] = b
+				j++
+			}
+		}
+		if j > 0 || err != nil {
+			return j, err
+		}
+	}
+}
+
+func (c *IMAPClient) WalkParts(uid UID, fn func(p *Part) error) error {
+	return c.WalkPartsContext(context.Background(), uid, fn)
+}
+
+// WalkPartsContext is like WalkMessage for the message with the given UID
+// in the selected mailbox, but only fetches its BODYSTRUCTURE up front.
+// The body of a part is fetched, without setting \Seen, when its Body is
+// first read, so parts fn is not interested in are never downloaded.
+func (c *IMAPClient) WalkPartsContext(ctx context.Context, uid UID, fn func(p *Part) error) error {
+	bs, err := c.bodyStructure(ctx, uid)
+	if err != nil {
+		return err
+	}
+	return bs.walk("", func(number string, part *BodyStructure) error {
+		return fn(&Part{
+			Number:    number,
+			MediaType: part.MediaType(),
+			Params:    part.Params,
+			Encoding:  part.Encoding,
+			Body: &lazyReader{open: func() (io.Reader, error) {
+				data, err := c.fetchPart(ctx, uid, number, part)
+				return bytes.NewReader(data), err
+			}},
+		})
+	})
+}
+
+func (c *IMAPClient) bodyStructure(ctx context.Context, uid UID) (*BodyStructure, error) {
+	results, err := c.UIDFetchMessagesContext(ctx, NewUIDSet(uid), "BODYSTRUCTURE")
+	if err != nil {
+		return nil, err
+	}
+	result, ok := results[uint32(uid)]
+	if !ok || result.BodyStructure == nil {
+		return nil, errors.New("No such message " + strconv.FormatUint(uint64(uid), 10))
+	}
+	return result.BodyStructure, nil
+}
+
+// walk calls fn for each leaf part below bs with its part number.
+func (bs *BodyStructure) walk(number string, fn func(number string, part *BodyStructure) error) error {
+	if bs.MIMEType == "multipart" {
+		for i, part := range bs.Parts {
+			if err := part.walk(childNumber(number, i+1), fn); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if number == "" {
+		number = "1"
+	}
+	return fn(number, bs)
+}
+
+// fetchPart fetches a leaf part of the message with the given UID, without
+// setting \Seen, and removes its transfer encoding.
+func (c *IMAPClient) fetchPart(ctx context.Context, uid UID, number string, part *BodyStructure) ([]byte, error) {
+	section := &BodySection{Part: parsePartNumber(number), Peek: true}
+	var buf bytes.Buffer
+	if _, err := c.UIDFetchToContext(ctx, uid, section.FetchItem(), &buf); err != nil {
+		return nil, err
+	}
+	return ioutil.ReadAll(DecodeTransferEncoding(part.Encoding, &buf))
+}
+
+func parsePartNumber(number string) []int {
+	var part []int
+	for _, s := range strings.Split(number, ".") {
+		n, _ := strconv.Atoi(s)
+		part = append(part, n)
+	}
+	return part
+}
+
+// lazyReader calls open on the first Read and then reads from its result.
+type lazyReader struct {
+	open func() (io.Reader, error)
+	r    io.Reader
+	err  error
+}
+
+func (l *lazyReader) Read(p []byte) (int, error) {
+	if l.r == nil && l.err == nil {
+		l.r, l.err = l.open()
+	}
+	if l.err != nil {
+		return 0, l.err
+	}
+	return l.r.Read(p)
+}
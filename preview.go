@@ -0,0 +1,81 @@
+package imap
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"strings"
+	"unicode/utf8"
+)
+
+// previewBytes is how much of the text part Preview fetches when the
+// server cannot generate previews.
+const previewBytes = 1024
+
+func (c *IMAPClient) Preview(uid UID, n int) (string, error) {
+	return c.PreviewContext(context.Background(), uid, n)
+}
+
+// PreviewContext returns a plain text snippet of at most n characters of
+// the message with the given UID, as shown below the subject in message
+// lists. Servers advertising PREVIEW generate it themselves; otherwise the
+// start of the text part is fetched, decoded and stripped of any HTML
+// markup. Messages without a text part have an empty preview.
+func (c *IMAPClient) PreviewContext(ctx context.Context, uid UID, n int) (string, error) {
+	if c.Supports("PREVIEW") {
+		results, err := c.UIDFetchMessagesContext(ctx, NewUIDSet(uid), "PREVIEW")
+		if err != nil {
+			return "", err
+		}
+		if result, ok := results[uint32(uid)]; ok {
+			return truncate(result.Preview, n), nil
+		}
+	}
+	bs, err := c.bodyStructure(ctx, uid)
+	if err != nil {
+		return "", err
+	}
+	number, part := bs.TextPart("text/plain", "text/html")
+	if part == nil {
+		return "", nil
+	}
+	count := previewBytes
+	if count < 4*n {
+		count = 4 * n
+	}
+	section := &BodySection{Part: parsePartNumber(number), Peek: true, Partial: true, Count: uint32(count)}
+	var buf bytes.Buffer
+	if _, err := c.UIDFetchToContext(ctx, uid, section.FetchItem(), &buf); err != nil {
+		return "", err
+	}
+	// The cut may fall inside an encoded quantum or character; decoding
+	// errors only cost the last few bytes.
+	data, _ := ioutil.ReadAll(DecodeTransferEncoding(part.Encoding, &buf))
+	r, err := DecodeCharset(part.Params["charset"], bytes.NewReader(data))
+	if err != nil {
+		return "", err
+	}
+	data, _ = ioutil.ReadAll(r)
+	text := string(data)
+	if part.MIMESubType == "html" {
+		if i := strings.LastIndexByte(text, '<'); i > strings.LastIndexByte(text, '>') {
+			text = text[:i]
+		}
+		text = HTMLToText(text)
+	}
+	return truncate(text, n), nil
+}
+
+// truncate collapses white space in s and cuts it to at most n
+// characters, dropping any invalid UTF-8 left by a cut in the middle of a
+// character.
+func truncate(s string, n int) string {
+	if n <= 0 {
+		return ""
+	}
+	s = strings.Join(strings.Fields(strings.ToValidUTF8(s, "")), " ")
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return string([]rune(s)[:n])
+}
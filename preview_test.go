@@ -0,0 +1,34 @@
+package imap
+
+import (
+	"testing"
+)
+
+func TestTruncate(t *testing.T) {
+	for _, tt := range []struct {
+		in   string
+		n    int
+		want string
+	}{
+		{"Hello,\r\n  world", 20, "Hello, world"},
+		{"Hello, world", 5, "Hello"},
+		{"Grüße aus Köln", 4, "Grüß"},
+		{"cut \xc3", 10, "cut"},
+		{"Hello", 0, ""},
+		{"Hello", -1, ""},
+	} {
+		if got := truncate(tt.in, tt.n); got != tt.want {
+			t.Errorf("truncate(%q, %d) = %q, want %q", tt.in, tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestPreviewNegative(t *testing.T) {
+	c := testClient(t, "* PREAUTH [CAPABILITY IMAP4rev1 PREVIEW] ready", func(s *fakeServer) {
+		tag := s.expect("UID FETCH 7 PREVIEW")
+		s.write(`* 1 FETCH (UID 7 PREVIEW "Hello")`, tag+" OK done")
+	})
+	if got, err := c.Preview(7, -1); got != "" || err != nil {
+		t.Errorf("got %q, %v", got, err)
+	}
+}
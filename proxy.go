@@ -0,0 +1,289 @@
+package imap
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+)
+
+// ProxyDialer matches golang.org/x/net/proxy.Dialer, so dialers from that
+// package can be used as Dialer.Proxy directly.
+type ProxyDialer interface {
+	Dial(network, addr string) (net.Conn, error)
+}
+
+// ContextDialer matches golang.org/x/net/proxy.ContextDialer. Proxies
+// implementing it are dialed with the context passed to Dialer.DialContext.
+type ContextDialer interface {
+	DialContext(ctx context.Context, network, addr string) (net.Conn, error)
+}
+
+type ProxyAuth struct {
+	User     string
+	Password string
+}
+
+type direct struct{}
+
+func (direct) Dial(network, addr string) (net.Conn, error) {
+	return net.Dial(network, addr)
+}
+
+func (direct) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	var d net.Dialer
+	return d.DialContext(ctx, network, addr)
+}
+
+var Direct ProxyDialer = direct{}
+
+func dialForward(ctx context.Context, forward ProxyDialer, network, addr string) (net.Conn, error) {
+	if d, ok := forward.(ContextDialer); ok {
+		return d.DialContext(ctx, network, addr)
+	}
+	return forward.Dial(network, addr)
+}
+
+type socks5 struct {
+	network string
+	addr    string
+	auth    *ProxyAuth
+	forward ProxyDialer
+}
+
+// SOCKS5 returns a ProxyDialer that connects to addr through the SOCKS5
+// proxy listening on network/proxyAddr, authenticating with auth if not nil.
+func SOCKS5(network, proxyAddr string, auth *ProxyAuth, forward ProxyDialer) (ProxyDialer, error) {
+	if forward == nil {
+		forward = Direct
+	}
+	return &socks5{
+		network: network,
+		addr:    proxyAddr,
+		auth:    auth,
+		forward: forward,
+	}, nil
+}
+
+func (s *socks5) Dial(network, addr string) (net.Conn, error) {
+	return s.DialContext(context.Background(), network, addr)
+}
+
+func (s *socks5) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	switch network {
+	case "tcp", "tcp4", "tcp6":
+	default:
+		return nil, errors.New("SOCKS5 proxy: unsupported network " + network)
+	}
+	conn, err := dialForward(ctx, s.forward, s.network, s.addr)
+	if err != nil {
+		return nil, err
+	}
+	stop := watchContext(ctx, conn, nil)
+	err = s.connect(conn, addr)
+	if cerr := stop(); cerr != nil {
+		err = cerr
+	}
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+func (s *socks5) connect(conn net.Conn, addr string) error {
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil || port < 1 || port > 0xffff {
+		return errors.New("SOCKS5 proxy: invalid port " + portStr)
+	}
+
+	buf := []byte{5, 1, 0}
+	if s.auth != nil {
+		buf = []byte{5, 2, 0, 2}
+	}
+	if _, err := conn.Write(buf); err != nil {
+		return err
+	}
+	buf = make([]byte, 2)
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		return err
+	}
+	if buf[0] != 5 {
+		return errors.New("SOCKS5 proxy: unexpected protocol version " + strconv.Itoa(int(buf[0])))
+	}
+	switch buf[1] {
+	case 0:
+	case 2:
+		if s.auth == nil {
+			return errors.New("SOCKS5 proxy: proxy requires authentication")
+		}
+		if len(s.auth.User) > 255 || len(s.auth.Password) > 255 {
+			return errors.New("SOCKS5 proxy: user name or password too long")
+		}
+		buf = []byte{1, byte(len(s.auth.User))}
+		buf = append(buf, s.auth.User...)
+		buf = append(buf, byte(len(s.auth.Password)))
+		buf = append(buf, s.auth.Password...)
+		if _, err := conn.Write(buf); err != nil {
+			return err
+		}
+		buf = make([]byte, 2)
+		if _, err := io.ReadFull(conn, buf); err != nil {
+			return err
+		}
+		if buf[0] != 1 {
+			return errors.New("SOCKS5 proxy: unexpected authentication version " + strconv.Itoa(int(buf[0])))
+		}
+		if buf[1] != 0 {
+			return errors.New("SOCKS5 proxy: authentication failed")
+		}
+	default:
+		return errors.New("SOCKS5 proxy: no acceptable authentication method")
+	}
+
+	buf = []byte{5, 1, 0}
+	if ip := net.ParseIP(host); ip != nil {
+		if ip4 := ip.To4(); ip4 != nil {
+			buf = append(buf, 1)
+			buf = append(buf, ip4...)
+		} else {
+			buf = append(buf, 4)
+			buf = append(buf, ip...)
+		}
+	} else {
+		if len(host) > 255 {
+			return errors.New("SOCKS5 proxy: host name too long")
+		}
+		buf = append(buf, 3, byte(len(host)))
+		buf = append(buf, host...)
+	}
+	buf = append(buf, byte(port>>8), byte(port))
+	if _, err := conn.Write(buf); err != nil {
+		return err
+	}
+
+	buf = make([]byte, 4)
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		return err
+	}
+	if buf[1] != 0 {
+		return errors.New("SOCKS5 proxy: connect failed with code " + strconv.Itoa(int(buf[1])))
+	}
+	var n int
+	switch buf[3] {
+	case 1:
+		n = net.IPv4len
+	case 4:
+		n = net.IPv6len
+	case 3:
+		if _, err := io.ReadFull(conn, buf[:1]); err != nil {
+			return err
+		}
+		n = int(buf[0])
+	default:
+		return errors.New("SOCKS5 proxy: unknown address type " + strconv.Itoa(int(buf[3])))
+	}
+	_, err = io.ReadFull(conn, make([]byte, n+2))
+	return err
+}
+
+type httpProxy struct {
+	network string
+	addr    string
+	auth    *ProxyAuth
+	forward ProxyDialer
+}
+
+// HTTPProxy returns a ProxyDialer that tunnels connections to addr through
+// the HTTP proxy on network/proxyAddr using the CONNECT method.
+func HTTPProxy(network, proxyAddr string, auth *ProxyAuth, forward ProxyDialer) (ProxyDialer, error) {
+	if forward == nil {
+		forward = Direct
+	}
+	return &httpProxy{
+		network: network,
+		addr:    proxyAddr,
+		auth:    auth,
+		forward: forward,
+	}, nil
+}
+
+func (p *httpProxy) Dial(network, addr string) (net.Conn, error) {
+	return p.DialContext(context.Background(), network, addr)
+}
+
+func (p *httpProxy) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	switch network {
+	case "tcp", "tcp4", "tcp6":
+	default:
+		return nil, errors.New("HTTP proxy: unsupported network " + network)
+	}
+	// addr goes into the request line as is.
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		return nil, err
+	}
+	for i := 0; i < len(addr); i++ {
+		if addr[i] <= ' ' || addr[i] == 0x7f {
+			return nil, errors.New("HTTP proxy: invalid address " + strconv.Quote(addr))
+		}
+	}
+	conn, err := dialForward(ctx, p.forward, p.network, p.addr)
+	if err != nil {
+		return nil, err
+	}
+	stop := watchContext(ctx, conn, nil)
+	c, err := p.connect(conn, addr)
+	if cerr := stop(); cerr != nil {
+		err = cerr
+	}
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+func (p *httpProxy) connect(conn net.Conn, addr string) (net.Conn, error) {
+	req := "CONNECT " + addr + " HTTP/1.1\r\nHost: " + addr + "\r\n"
+	if p.auth != nil {
+		cred := base64.StdEncoding.EncodeToString([]byte(p.auth.User + ":" + p.auth.Password))
+		req += "Proxy-Authorization: Basic " + cred + "\r\n"
+	}
+	req += "\r\n"
+	if _, err := io.WriteString(conn, req); err != nil {
+		return nil, err
+	}
+
+	r := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(r, &http.Request{Method: "CONNECT"})
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.New("HTTP proxy: " + resp.Status)
+	}
+	if r.Buffered() > 0 {
+		return &bufferedConn{Conn: conn, r: r}, nil
+	}
+	return conn, nil
+}
+
+// bufferedConn keeps bytes the server sent right after the proxy's reply,
+// such as the IMAP greeting, which would otherwise be lost in the reader.
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *bufferedConn) Read(b []byte) (int, error) {
+	return c.r.Read(b)
+}
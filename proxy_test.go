@@ -0,0 +1,94 @@
+package imap
+
+import (
+	"bufio"
+	"net"
+	"testing"
+)
+
+// pipeDialer hands out one end of a pipe whose other end serve handles.
+type pipeDialer struct {
+	t     *testing.T
+	serve func(conn net.Conn)
+}
+
+func (d *pipeDialer) Dial(network, addr string) (net.Conn, error) {
+	if d.serve == nil {
+		d.t.Errorf("unexpected dial of %s", addr)
+	}
+	client, server := net.Pipe()
+	go func() {
+		defer server.Close()
+		if d.serve != nil {
+			d.serve(server)
+		}
+	}()
+	return client, nil
+}
+
+func TestHTTPProxyInvalidAddr(t *testing.T) {
+	proxy, _ := HTTPProxy("tcp", "proxy:3128", nil, &pipeDialer{t: t})
+	for _, addr := range []string{
+		"imap.example.com:993\r\nX-Injected: 1",
+		"imap.example.com:993 HTTP/1.0",
+		"imap.example.com",
+	} {
+		if conn, err := proxy.Dial("tcp", addr); err == nil {
+			conn.Close()
+			t.Errorf("%q: got no error", addr)
+		}
+	}
+}
+
+func TestHTTPProxy(t *testing.T) {
+	proxy, _ := HTTPProxy("tcp", "proxy:3128", nil, &pipeDialer{t: t, serve: func(conn net.Conn) {
+		r := bufio.NewReader(conn)
+		if line, _ := r.ReadString('\n'); line != "CONNECT imap.example.com:993 HTTP/1.1\r\n" {
+			t.Errorf("got request %q", line)
+		}
+		for {
+			if line, err := r.ReadString('\n'); err != nil || line == "\r\n" {
+				break
+			}
+		}
+		conn.Write([]byte("HTTP/1.1 200 OK\r\n\r\n* OK ready\r\n"))
+	}})
+	conn, err := proxy.Dial("tcp", "imap.example.com:993")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if line, _ := bufio.NewReader(conn).ReadString('\n'); line != "* OK ready\r\n" {
+		t.Errorf("got %q", line)
+	}
+}
+
+func TestSOCKS5AuthVersion(t *testing.T) {
+	for _, tt := range []struct {
+		reply []byte
+		ok    bool
+	}{
+		{[]byte{1, 0}, true},
+		{[]byte{5, 0}, false},
+		{[]byte{1, 1}, false},
+	} {
+		proxy, _ := SOCKS5("tcp", "proxy:1080", &ProxyAuth{User: "user", Password: "pass"}, &pipeDialer{t: t, serve: func(conn net.Conn) {
+			buf := make([]byte, 4)
+			conn.Read(buf)
+			conn.Write([]byte{5, 2})
+			buf = make([]byte, 3+len("user")+len("pass"))
+			conn.Read(buf)
+			conn.Write(tt.reply)
+			buf = make([]byte, 7+len("imap.example.com"))
+			conn.Read(buf)
+			conn.Write([]byte{5, 0, 0, 1, 127, 0, 0, 1, 0, 143})
+		}})
+		conn, err := proxy.Dial("tcp", "imap.example.com:143")
+		if (err == nil) != tt.ok {
+			t.Errorf("auth reply %v: got %v", tt.reply, err)
+		}
+		if conn != nil {
+			conn.Close()
+		}
+	}
+}
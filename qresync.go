@@ -0,0 +1,84 @@
+package imap
+
+import (
+	"context"
+	"strconv"
+	"strings"
+)
+
+// SyncState is what a client remembers about a mailbox between sessions
+// to resynchronize it with SelectQResync.
+type SyncState struct {
+	UIDValidity uint32
+	// ModSeq is the HighestModSeq of the mailbox when last synchronized.
+	ModSeq uint64
+	// KnownUIDs, if not empty, limits the report of expunged messages to
+	// these UIDs.
+	KnownUIDs SeqSet
+}
+
+// Resync is what changed in a mailbox since the state given to
+// SelectQResync.
+type Resync struct {
+	Status *MailboxStatus
+	// Vanished are the UIDs of the messages expunged since.
+	Vanished SeqSet
+	// Changed are the messages added or whose flags changed since, keyed
+	// by UID, with their UID, Flags and ModSeq.
+	Changed map[uint32]*FetchResult
+}
+
+func (c *IMAPClient) SelectQResync(box string, state SyncState) (*Resync, error) {
+	return c.SelectQResyncContext(context.Background(), box, state)
+}
+
+// SelectQResyncContext selects box like SelectContext and has the server
+// report what changed since state (RFC 7162 QRESYNC), enabling QRESYNC
+// first if needed. If the UIDVALIDITY of the mailbox is no longer
+// state.UIDValidity, nothing is reported and the client has to
+// synchronize from scratch.
+func (c *IMAPClient) SelectQResyncContext(ctx context.Context, box string, state SyncState) (*Resync, error) {
+	if !c.Enabled("QRESYNC") {
+		if _, err := c.EnableContext(ctx, "QRESYNC"); err != nil {
+			return nil, err
+		}
+	}
+	param := "(QRESYNC (" + strconv.FormatUint(uint64(state.UIDValidity), 10) + " " + strconv.FormatUint(state.ModSeq, 10)
+	if !state.KnownUIDs.Empty() {
+		param += " " + state.KnownUIDs.String()
+	}
+	status, resp, err := c.selectMailbox(ctx, "SELECT", box, param+"))")
+	if err != nil {
+		return nil, err
+	}
+	resync := &Resync{Status: status, Changed: make(map[uint32]*FetchResult)}
+	for _, reply := range resp.Replys() {
+		if uids, _, ok := parseVanished(reply.Origin()); ok {
+			resync.Vanished.AddSet(uids)
+			continue
+		}
+		seq, items, ok := fetchItems(reply)
+		if !ok {
+			continue
+		}
+		result := &FetchResult{SeqNum: seq, Items: make(map[string]interface{})}
+		if err := result.parse(items); err != nil {
+			return nil, err
+		}
+		if result.UID != 0 {
+			resync.Changed[uint32(result.UID)] = result
+		}
+	}
+	return resync, nil
+}
+
+// parseVanished parses a VANISHED response, as in "VANISHED (EARLIER)
+// 41,43:116", returning its UIDs and whether it has the EARLIER tag.
+func parseVanished(origin string) (SeqSet, bool, bool) {
+	fields := strings.Fields(origin)
+	if len(fields) < 2 || !strings.EqualFold(fields[0], "VANISHED") {
+		return SeqSet{}, false, false
+	}
+	uids, err := ParseSeqSet(fields[len(fields)-1])
+	return uids, strings.EqualFold(fields[1], "(EARLIER)"), err == nil
+}
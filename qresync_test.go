@@ -0,0 +1,65 @@
+package imap
+
+import (
+	"testing"
+)
+
+func TestParseVanished(t *testing.T) {
+	for _, tt := range []struct {
+		origin  string
+		uids    string
+		earlier bool
+		ok      bool
+	}{
+		{"VANISHED (EARLIER) 41,43:116", "41,43:116", true, true},
+		{"VANISHED 405,407", "405,407", false, true},
+		{"vanished (earlier) 7", "7", true, true},
+		{"VANISHED", "", false, false},
+		{"VANISHED foo", "", false, false},
+		{"3 EXISTS", "", false, false},
+	} {
+		uids, earlier, ok := parseVanished(tt.origin)
+		if ok != tt.ok || earlier != tt.earlier || (ok && uids.String() != tt.uids) {
+			t.Errorf("%q: got %v, %v, %v", tt.origin, uids, earlier, ok)
+		}
+	}
+}
+
+func TestSelectQResync(t *testing.T) {
+	c := testClient(t, "* PREAUTH [CAPABILITY IMAP4rev1 QRESYNC] ready", func(s *fakeServer) {
+		tag := s.expect("ENABLE QRESYNC")
+		s.write("* ENABLED QRESYNC", tag+" OK enabled")
+		tag = s.expect(`SELECT "INBOX" (QRESYNC (67890007 20050715194045000 41:211,214:541))`)
+		s.write(
+			"* 314 EXISTS",
+			"* OK [UIDVALIDITY 67890007] UIDs valid",
+			"* OK [UIDNEXT 567] next UID",
+			"* OK [HIGHESTMODSEQ 20050715194045319] highest",
+			"* VANISHED (EARLIER) 41,43:116,118,120:211",
+			"* VANISHED (EARLIER) 214:540",
+			"* 49 FETCH (UID 117 FLAGS (\\Seen \\Answered) MODSEQ (90060115194045001))",
+			"* 50 FETCH (UID 119 FLAGS (\\Draft $MDNSent) MODSEQ (90060115194045308))",
+			tag+" OK [READ-WRITE] mailbox selected",
+		)
+	})
+	known, _ := ParseSeqSet("41:211,214:541")
+	resync, err := c.SelectQResync("INBOX", SyncState{UIDValidity: 67890007, ModSeq: 20050715194045000, KnownUIDs: known})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := resync.Vanished.String(); got != "41,43:116,118,120:211,214:540" {
+		t.Errorf("Vanished = %s", got)
+	}
+	if resync.Status.Messages != 314 || resync.Status.UIDValidity != 67890007 || resync.Status.HighestModSeq != 20050715194045319 {
+		t.Errorf("Status = %+v", resync.Status)
+	}
+	if len(resync.Changed) != 2 {
+		t.Fatalf("Changed = %v", resync.Changed)
+	}
+	if m := resync.Changed[119]; m == nil || m.SeqNum != 50 || m.ModSeq != 90060115194045308 || len(m.Flags) != 2 {
+		t.Errorf("Changed[119] = %+v", m)
+	}
+	if !c.Enabled("QRESYNC") || c.State() != SelectedState {
+		t.Errorf("got state %v, QRESYNC enabled %v", c.State(), c.Enabled("QRESYNC"))
+	}
+}
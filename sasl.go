@@ -0,0 +1,540 @@
+package imap
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// SASL is a client side SASL mechanism, as used by Authenticate. It has the
+// same method set as the Client interface of github.com/emersion/go-sasl.
+type SASL interface {
+	// Start begins the exchange, returning the mechanism name and an
+	// optional initial response. A nil ir means there is none.
+	Start() (mech string, ir []byte, err error)
+	// Next returns the response to a server challenge. If it returns both
+	// a response and an error, the response is still sent to let the
+	// server finish the exchange, and the error is reported afterwards.
+	Next(challenge []byte) (response []byte, err error)
+}
+
+// mutualSASL is implemented by mechanisms that also authenticate the
+// server, which Authenticate then requires to have happened.
+type mutualSASL interface {
+	serverVerified() bool
+}
+
+var ErrServerNotVerified = errors.New("Server accepted authentication without proving its identity")
+
+var ErrAuthenticated = errors.New("Session is already authenticated")
+
+func (c *IMAPClient) Authenticate(mech SASL) error {
+	return c.AuthenticateContext(context.Background(), mech)
+}
+
+// AuthenticateContext runs the AUTHENTICATE command with mech. If mech
+// fails during the exchange, the command is cancelled and its error is
+// returned. Mechanisms that authenticate the server, like SCRAM, fail
+// with ErrServerNotVerified and close the connection if the server
+// accepts without having proven itself. On an authenticated session it
+// fails with ErrAuthenticated without sending anything.
+func (c *IMAPClient) AuthenticateContext(ctx context.Context, mech SASL) error {
+	if c.State() != NotAuthenticatedState {
+		return ErrAuthenticated
+	}
+	caps, err := c.capabilities(ctx)
+	if err != nil {
+		return err
+	}
+	name, ir, err := mech.Start()
+	if err != nil {
+		return err
+	}
+
+	cmd := "AUTHENTICATE " + name
+	if ir != nil && caps["SASL-IR"] {
+		if len(ir) == 0 {
+			cmd += " ="
+		} else {
+			cmd += " " + base64.StdEncoding.EncodeToString(ir)
+		}
+		ir = nil
+	}
+
+	var mechErr error
+	c.mu.Lock()
+	c.caps = nil
+	c.mu.Unlock()
+	resp := c.execute(ctx, cmd, func(w io.Writer, text string) error {
+		var response []byte
+		if ir != nil {
+			response, ir = ir, nil
+		} else {
+			challenge, err := base64.StdEncoding.DecodeString(text)
+			if err != nil {
+				mechErr = errors.New("Invalid base64 in SASL challenge")
+				_, err = io.WriteString(w, "*\r\n")
+				return err
+			}
+			response, err = mech.Next(challenge)
+			if err != nil {
+				mechErr = err
+				if response == nil {
+					_, err = io.WriteString(w, "*\r\n")
+					return err
+				}
+			}
+		}
+		_, err := io.WriteString(w, base64.StdEncoding.EncodeToString(response)+"\r\n")
+		return err
+	})
+	if mechErr != nil {
+		return mechErr
+	}
+	if resp.Error() != nil {
+		return resp.Error()
+	}
+	if m, ok := mech.(mutualSASL); ok && !m.serverVerified() {
+		// The server may not be who it claims, so the session is not
+		// used any further.
+		c.conn.Close()
+		return ErrServerNotVerified
+	}
+	c.setState(AuthenticatedState, nil)
+	return nil
+}
+
+type plain struct {
+	identity string
+	username string
+	password string
+}
+
+// Plain returns the PLAIN mechanism of RFC 4616. identity is the user to
+// act as and is normally empty, meaning username itself.
+func Plain(identity, username, password string) SASL {
+	return &plain{
+		identity: identity,
+		username: username,
+		password: password,
+	}
+}
+
+func (m *plain) Start() (string, []byte, error) {
+	return "PLAIN", []byte(m.identity + "\x00" + m.username + "\x00" + m.password), nil
+}
+
+func (m *plain) Next(challenge []byte) ([]byte, error) {
+	return nil, errors.New("Unexpected PLAIN challenge")
+}
+
+// OAuthError is the error a server reports when an OAUTHBEARER or XOAUTH2
+// token is rejected.
+type OAuthError struct {
+	Status  string `json:"status"`
+	Schemes string `json:"schemes"`
+	Scope   string `json:"scope"`
+}
+
+func (e *OAuthError) Error() string {
+	return "OAuth authentication failed: " + e.Status
+}
+
+func oauthError(challenge []byte) error {
+	e := &OAuthError{}
+	if err := json.Unmarshal(challenge, e); err != nil || e.Status == "" {
+		return errors.New("OAuth authentication failed: " + string(challenge))
+	}
+	return e
+}
+
+// TokenSource supplies OAuth access tokens. The OAuth mechanisms built from
+// one call Token each time they start, so a mechanism kept around for
+// Reconnect never authenticates with an expired token. Implementations
+// should cache tokens until they expire, as golang.org/x/oauth2 sources do.
+type TokenSource interface {
+	Token() (string, error)
+}
+
+// TokenSourceFunc adapts a function to TokenSource, for instance a closure
+// around an oauth2.TokenSource returning its AccessToken.
+type TokenSourceFunc func() (string, error)
+
+func (f TokenSourceFunc) Token() (string, error) {
+	return f()
+}
+
+type staticToken string
+
+func (t staticToken) Token() (string, error) {
+	return string(t), nil
+}
+
+type oauthBearer struct {
+	username string
+	host     string
+	port     int
+	src      TokenSource
+}
+
+// OAuthBearer returns the OAUTHBEARER mechanism of RFC 7628. host and port
+// identify the server and may be left empty and zero.
+func OAuthBearer(username, host string, port int, token string) SASL {
+	return OAuthBearerSource(username, host, port, staticToken(token))
+}
+
+func OAuthBearerSource(username, host string, port int, src TokenSource) SASL {
+	return &oauthBearer{
+		username: username,
+		host:     host,
+		port:     port,
+		src:      src,
+	}
+}
+
+func (m *oauthBearer) Start() (string, []byte, error) {
+	token, err := m.src.Token()
+	if err != nil {
+		return "", nil, err
+	}
+	return "OAUTHBEARER", oauthBearerResponse(m.username, m.host, m.port, token), nil
+}
+
+func (m *oauthBearer) Next(challenge []byte) ([]byte, error) {
+	// A challenge carries the error; answering with a single ^A lets the
+	// server complete the exchange with a failure.
+	return []byte{1}, oauthError(challenge)
+}
+
+func oauthBearerResponse(username, host string, port int, token string) []byte {
+	resp := "n,"
+	if username != "" {
+		resp += "a=" + gs2Name(username)
+	}
+	resp += ",\x01"
+	if host != "" {
+		resp += "host=" + host + "\x01"
+	}
+	if port != 0 {
+		resp += "port=" + strconv.Itoa(port) + "\x01"
+	}
+	return []byte(resp + "auth=Bearer " + token + "\x01\x01")
+}
+
+// gs2Name escapes a name for use in a GS2 header (RFC 5801).
+func gs2Name(name string) string {
+	return strings.NewReplacer("=", "=3D", ",", "=2C").Replace(name)
+}
+
+type xoauth2 struct {
+	username string
+	src      TokenSource
+}
+
+// XOAuth2 returns Google's XOAUTH2 mechanism, still the only OAuth option on
+// some providers.
+func XOAuth2(username, token string) SASL {
+	return XOAuth2Source(username, staticToken(token))
+}
+
+func XOAuth2Source(username string, src TokenSource) SASL {
+	return &xoauth2{
+		username: username,
+		src:      src,
+	}
+}
+
+func (m *xoauth2) Start() (string, []byte, error) {
+	token, err := m.src.Token()
+	if err != nil {
+		return "", nil, err
+	}
+	return "XOAUTH2", []byte("user=" + m.username + "\x01auth=Bearer " + token + "\x01\x01"), nil
+}
+
+func (m *xoauth2) Next(challenge []byte) ([]byte, error) {
+	return []byte{}, oauthError(challenge)
+}
+
+type cramMD5 struct {
+	username string
+	password string
+}
+
+// CRAMMD5 returns the CRAM-MD5 mechanism of RFC 2195.
+func CRAMMD5(username, password string) SASL {
+	return &cramMD5{
+		username: username,
+		password: password,
+	}
+}
+
+func (m *cramMD5) Start() (string, []byte, error) {
+	return "CRAM-MD5", nil, nil
+}
+
+func (m *cramMD5) Next(challenge []byte) ([]byte, error) {
+	d := hmac.New(md5.New, []byte(m.password))
+	d.Write(challenge)
+	return []byte(m.username + " " + hex.EncodeToString(d.Sum(nil))), nil
+}
+
+// GSSAPIClient is the client side of a Kerberos V5 security context, to be
+// implemented on top of a GSSAPI or Kerberos library. The service ticket it
+// uses is normally for the host based service "imap@<server host>".
+type GSSAPIClient interface {
+	// InitSecContext advances context establishment with the server's
+	// token, which is nil on the first call. It returns the token to send
+	// and whether the context is now established.
+	InitSecContext(token []byte) (output []byte, established bool, err error)
+	Unwrap(token []byte) ([]byte, error)
+	Wrap(payload []byte) ([]byte, error)
+}
+
+type gssapi struct {
+	client      GSSAPIClient
+	authzid     string
+	established bool
+}
+
+// GSSAPI returns the GSSAPI mechanism of RFC 4752 using client for the
+// Kerberos exchange. authzid is the user to act as and is normally empty.
+// No security layer is negotiated; the session relies on TLS instead.
+func GSSAPI(client GSSAPIClient, authzid string) SASL {
+	return &gssapi{
+		client:  client,
+		authzid: authzid,
+	}
+}
+
+func (m *gssapi) Start() (string, []byte, error) {
+	out, established, err := m.client.InitSecContext(nil)
+	if err != nil {
+		return "", nil, err
+	}
+	m.established = established
+	return "GSSAPI", out, nil
+}
+
+func (m *gssapi) Next(challenge []byte) ([]byte, error) {
+	if !m.established {
+		out, established, err := m.client.InitSecContext(challenge)
+		if err != nil {
+			return nil, err
+		}
+		m.established = established
+		if out == nil {
+			out = []byte{}
+		}
+		return out, nil
+	}
+
+	layers, err := m.client.Unwrap(challenge)
+	if err != nil {
+		return nil, err
+	}
+	if len(layers) != 4 {
+		return nil, errors.New("Invalid GSSAPI security layer message")
+	}
+	if layers[0]&1 == 0 {
+		return nil, errors.New("Server requires a GSSAPI security layer")
+	}
+	return m.client.Wrap(append([]byte{1, 0, 0, 0}, m.authzid...))
+}
+
+// NTLMClient produces NTLM messages, to be implemented on top of an NTLM
+// library such as github.com/Azure/go-ntlmssp.
+type NTLMClient interface {
+	// Negotiate returns the NEGOTIATE_MESSAGE.
+	Negotiate() ([]byte, error)
+	// ChallengeResponse returns the AUTHENTICATE_MESSAGE answering the
+	// server's CHALLENGE_MESSAGE.
+	ChallengeResponse(challenge []byte) ([]byte, error)
+}
+
+type ntlm struct {
+	client NTLMClient
+	step   int
+}
+
+// NTLM returns the NTLM mechanism as offered by Exchange (MS-OXIMAP).
+func NTLM(client NTLMClient) SASL {
+	return &ntlm{client: client}
+}
+
+func (m *ntlm) Start() (string, []byte, error) {
+	return "NTLM", nil, nil
+}
+
+func (m *ntlm) Next(challenge []byte) ([]byte, error) {
+	m.step++
+	switch m.step {
+	case 1:
+		return m.client.Negotiate()
+	case 2:
+		return m.client.ChallengeResponse(challenge)
+	}
+	return nil, errors.New("Unexpected NTLM challenge")
+}
+
+type external struct {
+	identity string
+}
+
+// External returns the EXTERNAL mechanism of RFC 4422, which authenticates
+// with credentials established outside of SASL, typically the client
+// certificate in tls.Config.Certificates. identity is the user to act as
+// and is normally empty, meaning the one the certificate maps to.
+func External(identity string) SASL {
+	return &external{identity: identity}
+}
+
+func (m *external) Start() (string, []byte, error) {
+	return "EXTERNAL", []byte(m.identity), nil
+}
+
+func (m *external) Next(challenge []byte) ([]byte, error) {
+	return nil, errors.New("Unexpected EXTERNAL challenge")
+}
+
+// Credentials are what LoginAuto may use to authenticate. Either Password
+// or Tokens may be left empty.
+type Credentials struct {
+	Username string
+	Password string
+	Tokens   TokenSource
+}
+
+func (c *IMAPClient) LoginAuto(creds Credentials) (string, error) {
+	return c.LoginAutoContext(context.Background(), creds)
+}
+
+// LoginAutoContext tries the mechanisms the server advertises that creds
+// allow, in the order OAUTHBEARER, XOAUTH2, SCRAM-SHA-256(-PLUS),
+// SCRAM-SHA-1(-PLUS), PLAIN and finally LOGIN, until one succeeds. It
+// returns the name of that mechanism. Mechanisms the server refuses with
+// BAD are skipped, as are OAUTHBEARER and XOAUTH2 when the token is
+// rejected, letting the password be tried. Any other failure, such as a
+// NO for a wrong password, is returned at once, so that it does not count
+// as several failed logins. PLAIN and LOGIN are subject to the same
+// LOGINDISABLED check as LoginContext. If the session is already
+// authenticated it returns "PREAUTH".
+func (c *IMAPClient) LoginAutoContext(ctx context.Context, creds Credentials) (string, error) {
+	if c.State() != NotAuthenticatedState {
+		return "PREAUTH", nil
+	}
+	caps, err := c.capabilities(ctx)
+	if err != nil {
+		return "", err
+	}
+	cs, isTLS := c.TLSConnectionState()
+	plaintext := isTLS || c.AllowInsecureLogin || !caps["LOGINDISABLED"]
+
+	var names []string
+	var mechs []SASL
+	add := func(name string, mech SASL) {
+		if caps["AUTH="+name] {
+			names = append(names, name)
+			mechs = append(mechs, mech)
+		}
+	}
+	if creds.Tokens != nil {
+		port := 0
+		if _, p, err := net.SplitHostPort(c.conn.RemoteAddr().String()); err == nil {
+			port, _ = strconv.Atoi(p)
+		}
+		add("OAUTHBEARER", OAuthBearerSource(creds.Username, cs.ServerName, port, creds.Tokens))
+		add("XOAUTH2", XOAuth2Source(creds.Username, creds.Tokens))
+	}
+	if creds.Password != "" {
+		if isTLS {
+			if m, err := ScramSHA256Plus(creds.Username, creds.Password, cs); err == nil {
+				add("SCRAM-SHA-256-PLUS", m)
+			}
+		}
+		add("SCRAM-SHA-256", ScramSHA256(creds.Username, creds.Password))
+		if isTLS {
+			if m, err := ScramSHA1Plus(creds.Username, creds.Password, cs); err == nil {
+				add("SCRAM-SHA-1-PLUS", m)
+			}
+		}
+		add("SCRAM-SHA-1", ScramSHA1(creds.Username, creds.Password))
+		if plaintext {
+			add("PLAIN", Plain("", creds.Username, creds.Password))
+		}
+	}
+
+	var firstErr error
+	for i, mech := range mechs {
+		err := c.AuthenticateContext(ctx, mech)
+		if err == nil {
+			return names[i], nil
+		}
+		if !authFallback(names[i], err) {
+			return "", err
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	if creds.Password != "" && plaintext {
+		err := c.LoginContext(ctx, creds.Username, creds.Password)
+		if err == nil {
+			return "LOGIN", nil
+		}
+		return "", err
+	}
+	if firstErr == nil {
+		if creds.Password != "" && !plaintext {
+			return "", ErrLoginDisabled
+		}
+		firstErr = errors.New("No authentication mechanism supported by both server and credentials")
+	}
+	return "", firstErr
+}
+
+// authFallback reports whether LoginAutoContext may try the next
+// mechanism after mech failed with err.
+func authFallback(mech string, err error) bool {
+	var oauthErr *OAuthError
+	if errors.As(err, &oauthErr) {
+		return true
+	}
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) {
+		return false
+	}
+	return statusErr.Status == "BAD" || (statusErr.Status == "NO" && (mech == "OAUTHBEARER" || mech == "XOAUTH2"))
+}
+
+// MasterUserSeparator joins user and master user names for LoginAs on
+// servers without AUTH=PLAIN. It must match Dovecot's
+// auth_master_user_separator.
+var MasterUserSeparator = "*"
+
+func (c *IMAPClient) LoginAs(user, masterUser, masterPassword string) error {
+	return c.LoginAsContext(context.Background(), user, masterUser, masterPassword)
+}
+
+// LoginAsContext logs into the mailbox of user with the credentials of a
+// master (admin) user. It uses PLAIN with user as authorization identity,
+// which Dovecot and Cyrus both support, and otherwise LOGIN with the
+// Dovecot "user*masteruser" syntax.
+func (c *IMAPClient) LoginAsContext(ctx context.Context, user, masterUser, masterPassword string) error {
+	caps, err := c.capabilities(ctx)
+	if err != nil {
+		return err
+	}
+	if caps["AUTH=PLAIN"] {
+		return c.AuthenticateContext(ctx, Plain(user, masterUser, masterPassword))
+	}
+	return c.LoginContext(ctx, user+MasterUserSeparator+masterUser, masterPassword)
+}
@@ -0,0 +1,84 @@
+package imap
+
+import (
+	"strings"
+	"testing"
+)
+
+// expectNothing checks that the client sends no further command before
+// the connection is closed.
+func (s *fakeServer) expectNothing() {
+	if line, err := s.r.ReadString('\n'); err == nil {
+		s.t.Errorf("unexpected command %q", line)
+	}
+}
+
+func TestLoginAutoStopsOnNo(t *testing.T) {
+	c := testClient(t, "* OK [CAPABILITY IMAP4rev1 AUTH=SCRAM-SHA-256 AUTH=PLAIN] ready", func(s *fakeServer) {
+		tag := s.expect("AUTHENTICATE SCRAM-SHA-256")
+		s.write(tag + " NO [AUTHENTICATIONFAILED] Invalid credentials")
+		s.expectNothing()
+	})
+	_, err := c.LoginAuto(Credentials{Username: "user", Password: "wrong"})
+	if err == nil || !strings.Contains(err.Error(), "AUTHENTICATIONFAILED") {
+		t.Fatalf("got %v", err)
+	}
+	c.Close()
+}
+
+func TestLoginAutoSkipsUnsupported(t *testing.T) {
+	c := testClient(t, "* OK [CAPABILITY IMAP4rev1 AUTH=SCRAM-SHA-256 AUTH=PLAIN] ready", func(s *fakeServer) {
+		tag := s.expect("AUTHENTICATE SCRAM-SHA-256")
+		s.write(tag + " BAD Unsupported mechanism")
+		tag = s.expect("CAPABILITY")
+		s.write("* CAPABILITY IMAP4rev1 AUTH=SCRAM-SHA-256 AUTH=PLAIN", tag+" OK done")
+		tag = s.expect("AUTHENTICATE PLAIN")
+		s.write("+ ")
+		s.readLine()
+		s.write(tag + " OK done")
+	})
+	name, err := c.LoginAuto(Credentials{Username: "user", Password: "pass"})
+	if err != nil || name != "PLAIN" {
+		t.Fatalf("got %q, %v", name, err)
+	}
+}
+
+func TestLoginAutoLoginDisabled(t *testing.T) {
+	c := testClient(t, "* OK [CAPABILITY IMAP4rev1 AUTH=PLAIN LOGINDISABLED] ready", func(s *fakeServer) {
+		s.expectNothing()
+	})
+	if _, err := c.LoginAuto(Credentials{Username: "user", Password: "pass"}); err != ErrLoginDisabled {
+		t.Fatalf("got %v, want ErrLoginDisabled", err)
+	}
+	c.Close()
+}
+
+func TestLoginAutoTokenRejected(t *testing.T) {
+	c := testClient(t, "* OK [CAPABILITY IMAP4rev1 AUTH=XOAUTH2 AUTH=PLAIN] ready", func(s *fakeServer) {
+		tag := s.expect("AUTHENTICATE XOAUTH2")
+		s.write("+ ")
+		s.readLine()
+		s.write(tag + " NO [AUTHENTICATIONFAILED] Token expired")
+		tag = s.expect("CAPABILITY")
+		s.write("* CAPABILITY IMAP4rev1 AUTH=XOAUTH2 AUTH=PLAIN", tag+" OK done")
+		tag = s.expect("AUTHENTICATE PLAIN")
+		s.write("+ ")
+		s.readLine()
+		s.write(tag + " OK done")
+	})
+	tokens := TokenSourceFunc(func() (string, error) { return "expired", nil })
+	name, err := c.LoginAuto(Credentials{Username: "user", Password: "pass", Tokens: tokens})
+	if err != nil || name != "PLAIN" {
+		t.Fatalf("got %q, %v", name, err)
+	}
+}
+
+func TestAuthenticateAuthenticated(t *testing.T) {
+	c := testClient(t, "* PREAUTH ready", func(s *fakeServer) {
+		s.expectNothing()
+	})
+	if err := c.Authenticate(Plain("", "user", "pass")); err != ErrAuthenticated {
+		t.Errorf("got %v, want ErrAuthenticated", err)
+	}
+	c.Close()
+}
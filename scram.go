@@ -0,0 +1,192 @@
+package imap
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"hash"
+	"strconv"
+	"strings"
+)
+
+type scram struct {
+	name     string
+	h        func() hash.Hash
+	username string
+	password string
+
+	cbType string
+	cbData []byte
+
+	step            int
+	gs2Header       string
+	nonce           string
+	clientFirstBare string
+	serverSignature []byte
+	verified        bool
+}
+
+// maxScramIterations bounds the iteration count a server may ask for, so
+// that it cannot keep the client hashing for long.
+const maxScramIterations = 1 << 20
+
+// ScramSHA1 and ScramSHA256 return the SCRAM mechanisms of RFC 5802 and
+// RFC 7677, which prove knowledge of the password without sending it.
+func ScramSHA1(username, password string) SASL {
+	return newScram("SCRAM-SHA-1", sha1.New, username, password)
+}
+
+func ScramSHA256(username, password string) SASL {
+	return newScram("SCRAM-SHA-256", sha256.New, username, password)
+}
+
+// ScramSHA1Plus and ScramSHA256Plus are the channel binding variants,
+// which also tie the exchange to the TLS connection described by cs, as
+// returned by TLSConnectionState. tls-exporter is used on TLS 1.3 and
+// tls-unique on older versions.
+func ScramSHA1Plus(username, password string, cs tls.ConnectionState) (SASL, error) {
+	return newScramPlus("SCRAM-SHA-1-PLUS", sha1.New, username, password, cs)
+}
+
+func ScramSHA256Plus(username, password string, cs tls.ConnectionState) (SASL, error) {
+	return newScramPlus("SCRAM-SHA-256-PLUS", sha256.New, username, password, cs)
+}
+
+func newScram(name string, h func() hash.Hash, username, password string) *scram {
+	return &scram{
+		name:     name,
+		h:        h,
+		username: username,
+		password: password,
+	}
+}
+
+func newScramPlus(name string, h func() hash.Hash, username, password string, cs tls.ConnectionState) (SASL, error) {
+	m := newScram(name, h, username, password)
+	if cs.Version == tls.VersionTLS13 {
+		data, err := cs.ExportKeyingMaterial("EXPORTER-Channel-Binding", nil, 32)
+		if err != nil {
+			return nil, err
+		}
+		m.cbType, m.cbData = "tls-exporter", data
+	} else if cs.TLSUnique != nil {
+		m.cbType, m.cbData = "tls-unique", cs.TLSUnique
+	} else {
+		return nil, errors.New("No channel binding available for this TLS connection")
+	}
+	return m, nil
+}
+
+func (m *scram) Start() (string, []byte, error) {
+	nonce := make([]byte, 18)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", nil, err
+	}
+	m.nonce = base64.StdEncoding.EncodeToString(nonce)
+	m.gs2Header = "n,,"
+	if m.cbType != "" {
+		m.gs2Header = "p=" + m.cbType + ",,"
+	}
+	m.clientFirstBare = "n=" + gs2Name(m.username) + ",r=" + m.nonce
+	m.step = 1
+	return m.name, []byte(m.gs2Header + m.clientFirstBare), nil
+}
+
+func (m *scram) Next(challenge []byte) ([]byte, error) {
+	switch m.step {
+	case 1:
+		m.step++
+		return m.clientFinal(string(challenge))
+	case 2:
+		m.step++
+		attrs := scramAttributes(string(challenge))
+		if e, ok := attrs["e"]; ok {
+			return nil, errors.New("SCRAM authentication failed: " + e)
+		}
+		v, err := base64.StdEncoding.DecodeString(attrs["v"])
+		if err != nil || !hmac.Equal(v, m.serverSignature) {
+			return nil, errors.New("SCRAM server signature mismatch")
+		}
+		m.verified = true
+		return []byte{}, nil
+	}
+	return nil, errors.New("Unexpected SCRAM challenge")
+}
+
+// serverVerified reports whether the server proved it knows the password
+// with its signature.
+func (m *scram) serverVerified() bool {
+	return m.verified
+}
+
+func (m *scram) clientFinal(serverFirst string) ([]byte, error) {
+	attrs := scramAttributes(serverFirst)
+	if e, ok := attrs["e"]; ok {
+		return nil, errors.New("SCRAM authentication failed: " + e)
+	}
+	if _, ok := attrs["m"]; ok {
+		return nil, errors.New("SCRAM extension is not supported")
+	}
+	nonce := attrs["r"]
+	if !strings.HasPrefix(nonce, m.nonce) || len(nonce) == len(m.nonce) {
+		return nil, errors.New("SCRAM server nonce is invalid")
+	}
+	salt, err := base64.StdEncoding.DecodeString(attrs["s"])
+	if err != nil {
+		return nil, errors.New("SCRAM salt is invalid")
+	}
+	iter, err := strconv.Atoi(attrs["i"])
+	if err != nil || iter < 1 || iter > maxScramIterations {
+		return nil, errors.New("SCRAM iteration count is invalid")
+	}
+
+	cb := append([]byte(m.gs2Header), m.cbData...)
+	withoutProof := "c=" + base64.StdEncoding.EncodeToString(cb) + ",r=" + nonce
+	authMessage := []byte(m.clientFirstBare + "," + serverFirst + "," + withoutProof)
+
+	salted := m.hi([]byte(m.password), salt, iter)
+	clientKey := m.hmac(salted, []byte("Client Key"))
+	d := m.h()
+	d.Write(clientKey)
+	storedKey := d.Sum(nil)
+	proof := m.hmac(storedKey, authMessage)
+	for i := range proof {
+		proof[i] ^= clientKey[i]
+	}
+	m.serverSignature = m.hmac(m.hmac(salted, []byte("Server Key")), authMessage)
+
+	return []byte(withoutProof + ",p=" + base64.StdEncoding.EncodeToString(proof)), nil
+}
+
+func (m *scram) hmac(key, data []byte) []byte {
+	d := hmac.New(m.h, key)
+	d.Write(data)
+	return d.Sum(nil)
+}
+
+// hi is PBKDF2 with the output length of the hash, as defined by RFC 5802.
+func (m *scram) hi(password, salt []byte, iter int) []byte {
+	u := m.hmac(password, append(append([]byte{}, salt...), 0, 0, 0, 1))
+	result := append([]byte{}, u...)
+	for i := 1; i < iter; i++ {
+		u = m.hmac(password, u)
+		for j := range result {
+			result[j] ^= u[j]
+		}
+	}
+	return result
+}
+
+func scramAttributes(s string) map[string]string {
+	attrs := make(map[string]string)
+	for _, field := range strings.Split(s, ",") {
+		if i := strings.IndexByte(field, '='); i == 1 {
+			attrs[field[:1]] = field[2:]
+		}
+	}
+	return attrs
+}
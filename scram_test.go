@@ -0,0 +1,99 @@
+package imap
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+)
+
+func TestScramVectors(t *testing.T) {
+	tests := []struct {
+		name                    string
+		mech                    *scram
+		nonce                   string
+		serverFirst, clientLast string
+		serverFinal             string
+	}{
+		{
+			// RFC 5802, section 5.
+			"SCRAM-SHA-1", ScramSHA1("user", "pencil").(*scram),
+			"fyko+d2lbbFgONRv9qkxdawL",
+			"r=fyko+d2lbbFgONRv9qkxdawL3rfcNHYJY1ZVvWVs7j,s=QSXCR+Q6sek8bf92,i=4096",
+			"c=biws,r=fyko+d2lbbFgONRv9qkxdawL3rfcNHYJY1ZVvWVs7j,p=v0X8v3Bz2T0CJGbJQyF0X+HI4Ts=",
+			"v=rmF9pqV8S7suAoZWja4dJRkFsKQ=",
+		},
+		{
+			// RFC 7677, section 3.
+			"SCRAM-SHA-256", ScramSHA256("user", "pencil").(*scram),
+			"rOprNGfwEbeRWgbNEkqO",
+			"r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,s=W22ZaJ0SNY7soEsUEjb6gQ==,i=4096",
+			"c=biws,r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,p=dHzbZapWIk4jUhN+Ute9ytag9zjfMHgsqmmiz7AndVQ=",
+			"v=6rriTRBi23WpRR/wtup+mMhUZUn/dB5nLTJRsjl95G4=",
+		},
+	}
+	for _, test := range tests {
+		name, _, err := test.mech.Start()
+		if err != nil || name != test.name {
+			t.Fatalf("%s: Start returned %q, %v", test.name, name, err)
+		}
+		test.mech.nonce = test.nonce
+		test.mech.clientFirstBare = "n=user,r=" + test.nonce
+		resp, err := test.mech.Next([]byte(test.serverFirst))
+		if err != nil || string(resp) != test.clientLast {
+			t.Errorf("%s: client-final %q, %v", test.name, resp, err)
+			continue
+		}
+		if test.mech.serverVerified() {
+			t.Errorf("%s: verified before server-final", test.name)
+		}
+		if _, err := test.mech.Next([]byte(test.serverFinal)); err != nil || !test.mech.serverVerified() {
+			t.Errorf("%s: server-final: %v", test.name, err)
+		}
+	}
+}
+
+func TestScramRejects(t *testing.T) {
+	tests := []struct {
+		name        string
+		serverFirst string
+		serverFinal string
+	}{
+		{"error", "e=unknown-user", ""},
+		{"nonce", "r=other,s=QSXCR+Q6sek8bf92,i=4096", ""},
+		{"iterations", "r=%sx,s=QSXCR+Q6sek8bf92,i=100000000", ""},
+		{"extension", "m=ext,r=%sx,s=QSXCR+Q6sek8bf92,i=4096", ""},
+		{"final error", "r=%sx,s=QSXCR+Q6sek8bf92,i=1", "e=invalid-proof"},
+		{"signature", "r=%sx,s=QSXCR+Q6sek8bf92,i=1", "v=AAAA"},
+	}
+	for _, test := range tests {
+		m := ScramSHA256("user", "pencil").(*scram)
+		m.Start()
+		_, err := m.Next([]byte(strings.Replace(test.serverFirst, "%s", m.nonce, 1)))
+		if err == nil && test.serverFinal != "" {
+			_, err = m.Next([]byte(test.serverFinal))
+		}
+		if err == nil || m.serverVerified() {
+			t.Errorf("%s: accepted", test.name)
+		}
+	}
+}
+
+func TestAuthenticateRequiresServerSignature(t *testing.T) {
+	c := testClient(t, "* OK [CAPABILITY IMAP4rev1 AUTH=SCRAM-SHA-256] ready", func(s *fakeServer) {
+		line := s.readLine()
+		tag := strings.SplitN(line, " ", 2)[0]
+		s.write("+ ")
+		clientFirst, _ := base64.StdEncoding.DecodeString(s.readLine())
+		nonce := scramAttributes(string(clientFirst))["r"]
+		serverFirst := "r=" + nonce + "x,s=QSXCR+Q6sek8bf92,i=1"
+		s.write("+ " + base64.StdEncoding.EncodeToString([]byte(serverFirst)))
+		s.readLine()
+		s.write(tag + " OK done")
+	})
+	if err := c.Authenticate(ScramSHA256("user", "pencil")); err != ErrServerNotVerified {
+		t.Fatalf("got %v, want ErrServerNotVerified", err)
+	}
+	if c.State() != NotAuthenticatedState {
+		t.Fatal("session authenticated")
+	}
+}
@@ -0,0 +1,209 @@
+package imap
+
+import (
+	"context"
+	"strings"
+)
+
+// Result options of SearchReturn (RFC 4731).
+const (
+	SearchMin   = "MIN"
+	SearchMax   = "MAX"
+	SearchAll   = "ALL"
+	SearchCount = "COUNT"
+	// SearchSave keeps the result on the server for SavedResult to refer
+	// to. It needs the SEARCHRES extension.
+	SearchSave = "SAVE"
+	// SearchUpdate asks the server to keep the result up to date, sending
+	// changes as Updates with Search set until CancelUpdate. It needs the
+	// CONTEXT=SEARCH or CONTEXT=SORT extension (RFC 5267).
+	SearchUpdate = "UPDATE"
+	// SearchContextHint tells the server the result will be paged through
+	// with SearchPartial, so that it may keep it around.
+	SearchContextHint = "CONTEXT"
+)
+
+// SearchPartial returns the result option for the matches from the first
+// to the last, counting from 1, or from -1 backwards from the end if both
+// are negative, for paging through results (RFC 9394 PARTIAL). They are
+// returned in SearchData.Partial.
+func SearchPartial(first, last int) string {
+	return partialRange(first, last)
+}
+
+// SearchData is the result of SearchReturn, as reported by an ESEARCH
+// response. Fields of options that were not requested are zero.
+type SearchData struct {
+	Min   uint32
+	Max   uint32
+	All   SeqSet
+	Count uint32
+	// Partial holds the page of results asked for with SearchPartial.
+	Partial SeqSet
+	// ModSeq is the highest mod-sequence of the matching messages when
+	// searching by MODSEQ.
+	ModSeq uint64
+	// Tag is the tag of the command that made the search, which identifies
+	// it in later updates and to CancelUpdate.
+	Tag string
+	// AddTo and RemoveFrom are the changes to a result kept up to date
+	// with SearchUpdate, as reported by the updates.
+	AddTo      []ContextChange
+	RemoveFrom []ContextChange
+}
+
+// ContextChange is a change to a result kept up to date with SearchUpdate:
+// the messages in Set were added to or removed from it at Position,
+// counting from 1, or 0 if the result is not sorted or the server does not
+// say.
+type ContextChange struct {
+	Position uint32
+	Set      SeqSet
+}
+
+func (c *IMAPClient) SearchReturn(options []string, criteria ...interface{}) (*SearchData, error) {
+	return c.SearchReturnContext(context.Background(), options, criteria...)
+}
+
+// SearchReturnContext is like SearchContext but only returns what options
+// ask for, such as SearchCount, which saves transferring every number when
+// only the count or the lowest is wanted. It needs the ESEARCH extension.
+// Without options the server returns ALL.
+func (c *IMAPClient) SearchReturnContext(ctx context.Context, options []string, criteria ...interface{}) (*SearchData, error) {
+	return c.searchReturn(ctx, "SEARCH", options, criteria)
+}
+
+// UIDSearchReturn is like SearchReturn but its results are UIDs.
+func (c *IMAPClient) UIDSearchReturn(options []string, criteria ...interface{}) (*SearchData, error) {
+	return c.UIDSearchReturnContext(context.Background(), options, criteria...)
+}
+
+func (c *IMAPClient) UIDSearchReturnContext(ctx context.Context, options []string, criteria ...interface{}) (*SearchData, error) {
+	return c.searchReturn(ctx, "UID SEARCH", options, criteria)
+}
+
+func (c *IMAPClient) searchReturn(ctx context.Context, cmd string, options []string, criteria []interface{}) (*SearchData, error) {
+	if err := checkCriteria(criteria); err != nil {
+		return nil, err
+	}
+	args := []interface{}{cmd, "RETURN (" + strings.Join(options, " ") + ")"}
+	if needsCharset(criteria) {
+		args = append(args, "CHARSET", "UTF-8")
+	}
+	return esearchResult(c.command(ctx, append(args, criteria...)...))
+}
+
+// esearchResult returns the result of a command answered with ESEARCH,
+// leaving out updates to the results of other commands.
+func esearchResult(resp *Response) (*SearchData, error) {
+	if resp.Error() != nil {
+		return nil, resp.Error()
+	}
+	data := &SearchData{}
+	for _, reply := range resp.Replys() {
+		args, ok := replyArgs(reply, "ESEARCH")
+		if !ok {
+			continue
+		}
+		fields, err := parseFields(args)
+		if err != nil {
+			continue
+		}
+		if tag := esearchTag(fields); tag != "" && tag != resp.Id() {
+			continue
+		}
+		if err := data.parse(fields); err != nil {
+			return nil, err
+		}
+	}
+	return data, nil
+}
+
+func esearchTag(fields []interface{}) string {
+	if len(fields) > 0 {
+		if list := asList(fields[0]); len(list) == 2 && strings.EqualFold(asString(list[0]), "TAG") {
+			return asString(list[1])
+		}
+	}
+	return ""
+}
+
+func (c *IMAPClient) CancelUpdate(tags ...string) error {
+	return c.CancelUpdateContext(context.Background(), tags...)
+}
+
+// CancelUpdateContext stops the updates to the results of the searches
+// with the given tags, as asked for with SearchUpdate.
+func (c *IMAPClient) CancelUpdateContext(ctx context.Context, tags ...string) error {
+	args := []interface{}{"CANCELUPDATE"}
+	for _, tag := range tags {
+		args = append(args, Quoted(tag))
+	}
+	return c.command(ctx, args...).Error()
+}
+
+// parse reads the search return data of an ESEARCH response, after the
+// optional (TAG "...") correlator and UID indicator.
+func (data *SearchData) parse(fields []interface{}) error {
+	if tag := esearchTag(fields); tag != "" {
+		data.Tag = tag
+		fields = fields[1:]
+	}
+	if len(fields) > 0 && strings.EqualFold(asString(fields[0]), "UID") {
+		fields = fields[1:]
+	}
+	for i := 0; i+1 < len(fields); i += 2 {
+		value := asString(fields[i+1])
+		switch strings.ToUpper(asString(fields[i])) {
+		case SearchMin:
+			data.Min, _ = asNumber(value)
+		case SearchMax:
+			data.Max, _ = asNumber(value)
+		case SearchCount:
+			data.Count, _ = asNumber(value)
+		case SearchAll:
+			all, err := ParseSeqSet(value)
+			if err != nil {
+				return err
+			}
+			data.All = all
+		case "PARTIAL":
+			// (range set), where set is NIL if the page is empty.
+			if list := asList(fields[i+1]); len(list) == 2 && list[1] != nil {
+				partial, err := ParseSeqSet(asString(list[1]))
+				if err != nil {
+					return err
+				}
+				data.Partial = partial
+			}
+		case "MODSEQ":
+			data.ModSeq, _ = asNumber64(value)
+		case "ADDTO", "REMOVEFROM":
+			changes, err := parseContextChanges(asList(fields[i+1]))
+			if err != nil {
+				return err
+			}
+			if strings.EqualFold(asString(fields[i]), "ADDTO") {
+				data.AddTo = append(data.AddTo, changes...)
+			} else {
+				data.RemoveFrom = append(data.RemoveFrom, changes...)
+			}
+		}
+	}
+	return nil
+}
+
+// parseContextChanges parses the (position set ...) of ADDTO and
+// REMOVEFROM.
+func parseContextChanges(list []interface{}) ([]ContextChange, error) {
+	var changes []ContextChange
+	for i := 0; i+1 < len(list); i += 2 {
+		position, _ := asNumber(list[i])
+		set, err := ParseSeqSet(asString(list[i+1]))
+		if err != nil {
+			return nil, err
+		}
+		changes = append(changes, ContextChange{position, set})
+	}
+	return changes, nil
+}
@@ -0,0 +1,32 @@
+package imap
+
+import "testing"
+
+func TestFetchSavedResult(t *testing.T) {
+	c := testClient(t, "* PREAUTH ready", func(s *fakeServer) {
+		tag := s.expect("SEARCH RETURN (SAVE) UNSEEN")
+		s.write(tag + " OK done")
+		tag = s.expect("UID FETCH $ BODY.PEEK[]")
+		s.write("* 3 FETCH (UID 7 BODY[] {5}", "hello)", tag+" OK done")
+	})
+	data, err := c.SearchReturn([]string{SearchSave}, "UNSEEN")
+	if err != nil || data == nil {
+		t.Fatalf("search: %+v, %v", data, err)
+	}
+	body, err := c.UIDFetch(SavedResult(), "BODY.PEEK[]")
+	if err != nil || body != "hello" {
+		t.Fatalf("fetch: %q, %v", body, err)
+	}
+}
+
+func TestSearchReturnSkipsOtherReplies(t *testing.T) {
+	c := testClient(t, "* PREAUTH ready", func(s *fakeServer) {
+		tag := s.expect("SEARCH RETURN (MIN COUNT) UNSEEN")
+		s.write(noise...)
+		s.write(`* ESEARCH (TAG "other") ADDTO (0 9)`, `* ESEARCH (TAG "`+tag+`") MIN 2 COUNT 5`, tag+" OK done")
+	})
+	data, err := c.SearchReturn([]string{SearchMin, SearchCount}, "UNSEEN")
+	if err != nil || data.Min != 2 || data.Count != 5 || data.AddTo != nil {
+		t.Fatalf("got %+v, %v", data, err)
+	}
+}
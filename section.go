@@ -0,0 +1,117 @@
+package imap
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Section specifiers of a BodySection.
+const (
+	SectionHeader          = "HEADER"
+	SectionHeaderFields    = "HEADER.FIELDS"
+	SectionHeaderFieldsNot = "HEADER.FIELDS.NOT"
+	SectionText            = "TEXT"
+	SectionMIME            = "MIME"
+)
+
+// BodySection selects what a BODY[...] fetch item returns: a MIME part,
+// or the whole message if Part is empty, optionally only its header or
+// text as given by Specifier, and optionally only a range of bytes.
+//
+//	&BodySection{Part: []int{1, 2}}                          // BODY[1.2]
+//	&BodySection{Specifier: SectionHeader}                   // BODY[HEADER]
+//	&BodySection{Part: []int{3}, Partial: true, Count: 1024} // BODY[3]<0.1024>
+type BodySection struct {
+	Part      []int
+	Specifier string
+	// Fields are the header fields of SectionHeaderFields and
+	// SectionHeaderFieldsNot.
+	Fields []string
+	// Peek fetches with BODY.PEEK, which unlike BODY does not set the
+	// \Seen flag.
+	Peek bool
+
+	Partial bool
+	Offset  uint32
+	Count   uint32
+}
+
+// FetchItem returns the fetch item name to pass to FetchMessages.
+func (s *BodySection) FetchItem() string {
+	item := "BODY[" + s.spec() + "]"
+	if s.Peek {
+		item = "BODY.PEEK[" + s.spec() + "]"
+	}
+	if s.Partial {
+		item += "<" + strconv.FormatUint(uint64(s.Offset), 10) + "." + strconv.FormatUint(uint64(s.Count), 10) + ">"
+	}
+	return item
+}
+
+func (s *BodySection) spec() string {
+	parts := make([]string, 0, len(s.Part)+1)
+	for _, n := range s.Part {
+		parts = append(parts, strconv.Itoa(n))
+	}
+	if s.Specifier != "" {
+		spec := strings.ToUpper(s.Specifier)
+		if len(s.Fields) > 0 {
+			spec += " (" + strings.ToUpper(strings.Join(s.Fields, " ")) + ")"
+		}
+		parts = append(parts, spec)
+	}
+	return strings.Join(parts, ".")
+}
+
+// resultName returns the item name the server uses for the section in its
+// response, where a partial range only gives the offset.
+func (s *BodySection) resultName() string {
+	name := "BODY[" + s.spec() + "]"
+	if s.Partial {
+		name += "<" + strconv.FormatUint(uint64(s.Offset), 10) + ">"
+	}
+	return name
+}
+
+// Body returns the data of section in the result, and whether it was
+// there.
+func (result *FetchResult) Body(section *BodySection) (string, bool) {
+	name := section.resultName()
+	if value, ok := result.Items[name]; ok {
+		return asString(value), true
+	}
+	if len(section.Fields) == 0 {
+		return "", false
+	}
+	// Servers may quote or reorder the header field names they echo.
+	i := strings.Index(name, " (")
+	if i < 0 {
+		return "", false
+	}
+	prefix := name[:i]
+	for key, value := range result.Items {
+		if strings.HasPrefix(key, prefix+" (") {
+			return asString(value), true
+		}
+	}
+	return "", false
+}
+
+// PeekItem returns the variant of a fetch item that does not set the \Seen
+// flag: BODY[...] becomes BODY.PEEK[...], and RFC822, RFC822.TEXT and
+// RFC822.HEADER become the equivalent BODY.PEEK[] items. Other items are
+// returned unchanged.
+func PeekItem(item string) string {
+	upper := strings.ToUpper(item)
+	switch {
+	case strings.HasPrefix(upper, "BODY["):
+		return "BODY.PEEK" + item[len("BODY"):]
+	case upper == "RFC822":
+		return "BODY.PEEK[]"
+	case upper == "RFC822.TEXT":
+		return "BODY.PEEK[TEXT]"
+	case upper == "RFC822.HEADER":
+		return "BODY.PEEK[HEADER]"
+	}
+	return item
+}
@@ -0,0 +1,58 @@
+package imap
+
+import "testing"
+
+func TestBodySectionFetchItem(t *testing.T) {
+	tests := []struct {
+		section *BodySection
+		item    string
+	}{
+		{&BodySection{}, "BODY[]"},
+		{&BodySection{Part: []int{1, 2}, Peek: true}, "BODY.PEEK[1.2]"},
+		{&BodySection{Specifier: SectionHeaderFields, Fields: []string{"From", "Subject"}}, "BODY[HEADER.FIELDS (FROM SUBJECT)]"},
+		{&BodySection{Part: []int{3}, Specifier: SectionMIME}, "BODY[3.MIME]"},
+		{&BodySection{Part: []int{3}, Partial: true, Offset: 10, Count: 1024}, "BODY[3]<10.1024>"},
+	}
+	for _, test := range tests {
+		if item := test.section.FetchItem(); item != test.item {
+			t.Errorf("got %q, want %q", item, test.item)
+		}
+	}
+}
+
+func TestFetchResultBody(t *testing.T) {
+	result := &FetchResult{Items: map[string]interface{}{
+		"BODY[HEADER.FIELDS (SUBJECT FROM)]": "From: a\r\n",
+		"BODY[3]<10>":                        "partial",
+	}}
+	tests := []struct {
+		section *BodySection
+		body    string
+		ok      bool
+	}{
+		{&BodySection{Specifier: SectionHeaderFields, Fields: []string{"From", "Subject"}}, "From: a\r\n", true},
+		{&BodySection{Part: []int{3}, Partial: true, Offset: 10, Count: 20}, "partial", true},
+		{&BodySection{Part: []int{1}}, "", false},
+		{&BodySection{Fields: []string{"From"}}, "", false},
+	}
+	for _, test := range tests {
+		body, ok := result.Body(test.section)
+		if body != test.body || ok != test.ok {
+			t.Errorf("%s: got %q, %v", test.section.FetchItem(), body, ok)
+		}
+	}
+}
+
+func TestPeekItem(t *testing.T) {
+	for item, want := range map[string]string{
+		"BODY[1.TEXT]":  "BODY.PEEK[1.TEXT]",
+		"body[]<0.100>": "BODY.PEEK[]<0.100>",
+		"RFC822":        "BODY.PEEK[]",
+		"RFC822.HEADER": "BODY.PEEK[HEADER]",
+		"FLAGS":         "FLAGS",
+	} {
+		if got := PeekItem(item); got != want {
+			t.Errorf("%s: got %q, want %q", item, got, want)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package imap
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// SeqSet is a set of message sequence numbers or UIDs such as
+// "1:5,8,11:*". The zero value is an empty set. In ranges, 0 stands for
+// "*", the largest number in use.
+type SeqSet struct {
+	ranges []seqRange
+	// saved makes the set "$"; see SavedResult.
+	saved bool
+}
+
+type seqRange struct {
+	start, stop uint32
+}
+
+// UID is the unique identifier of a message, as opposed to its sequence
+// number.
+type UID uint32
+
+// NewSeqSet returns a set of the given numbers.
+func NewSeqSet(nums ...uint32) SeqSet {
+	var set SeqSet
+	set.AddNum(nums...)
+	return set
+}
+
+// NewUIDSet returns a set of the given UIDs.
+func NewUIDSet(uids ...UID) SeqSet {
+	var set SeqSet
+	for _, uid := range uids {
+		set.AddNum(uint32(uid))
+	}
+	return set
+}
+
+// SavedResult returns the set "$", which stands for the result of the last
+// search issued with SearchSave (RFC 5182 SEARCHRES), so that commands on
+// the messages found need not send their numbers back. Its contents are
+// only known to the server; adding numbers to it has no effect.
+func SavedResult() SeqSet {
+	return SeqSet{saved: true}
+}
+
+// ParseSeqSet parses a sequence set in IMAP syntax, including "$".
+func ParseSeqSet(s string) (SeqSet, error) {
+	if s == "$" {
+		return SavedResult(), nil
+	}
+	var set SeqSet
+	for _, part := range strings.Split(s, ",") {
+		bounds := strings.SplitN(part, ":", 2)
+		start, err := parseSeqNum(bounds[0])
+		if err != nil {
+			return SeqSet{}, err
+		}
+		stop := start
+		if len(bounds) == 2 {
+			if stop, err = parseSeqNum(bounds[1]); err != nil {
+				return SeqSet{}, err
+			}
+		}
+		set.AddRange(start, stop)
+	}
+	return set, nil
+}
+
+func parseSeqNum(s string) (uint32, error) {
+	if s == "*" {
+		return 0, nil
+	}
+	n, err := strconv.ParseUint(s, 10, 32)
+	if err != nil || n == 0 {
+		return 0, errors.New("Invalid sequence number " + s)
+	}
+	return uint32(n), nil
+}
+
+// AddNum adds the given numbers to the set.
+func (set *SeqSet) AddNum(nums ...uint32) {
+	for _, n := range nums {
+		set.AddRange(n, n)
+	}
+}
+
+// AddRange adds the numbers from start to stop inclusive. Either may be 0
+// for "*".
+func (set *SeqSet) AddRange(start, stop uint32) {
+	if stop != 0 && (start == 0 || start > stop) {
+		start, stop = stop, start
+	}
+	if n := len(set.ranges); n > 0 && start != 0 {
+		last := &set.ranges[n-1]
+		if last.stop != 0 && last.start <= start && start <= last.stop+1 {
+			if stop == 0 || stop > last.stop {
+				last.stop = stop
+			}
+			return
+		}
+	}
+	set.ranges = append(set.ranges, seqRange{start, stop})
+}
+
+// AddSet adds the numbers in other.
+func (set *SeqSet) AddSet(other SeqSet) {
+	for _, r := range other.ranges {
+		set.AddRange(r.start, r.stop)
+	}
+}
+
+// Contains reports whether n is in the set, taking "*" to be larger than
+// any number.
+func (set SeqSet) Contains(n uint32) bool {
+	for _, r := range set.ranges {
+		if r.start == 0 && r.stop == 0 {
+			return true
+		}
+		if r.start <= n && (r.stop == 0 || n <= r.stop) {
+			return true
+		}
+	}
+	return false
+}
+
+func (set SeqSet) Empty() bool {
+	return len(set.ranges) == 0 && !set.saved
+}
+
+// String returns the set in IMAP syntax.
+func (set SeqSet) String() string {
+	if set.saved {
+		return "$"
+	}
+	parts := make([]string, len(set.ranges))
+	for i, r := range set.ranges {
+		parts[i] = formatSeqNum(r.start)
+		if r.stop != r.start {
+			parts[i] += ":" + formatSeqNum(r.stop)
+		}
+	}
+	return strings.Join(parts, ",")
+}
+
+func formatSeqNum(n uint32) string {
+	if n == 0 {
+		return "*"
+	}
+	return strconv.FormatUint(uint64(n), 10)
+}
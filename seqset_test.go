@@ -0,0 +1,71 @@
+package imap
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSeqSetString(t *testing.T) {
+	tests := []struct {
+		set  SeqSet
+		want string
+	}{
+		{SeqSet{}, ""},
+		{NewSeqSet(1, 2, 3, 5), "1:3,5"},
+		{NewSeqSet(5, 3, 4), "5,3:4"},
+		{NewUIDSet(7), "7"},
+		{SavedResult(), "$"},
+	}
+	for _, test := range tests {
+		if got := test.set.String(); got != test.want {
+			t.Errorf("got %q, want %q", got, test.want)
+		}
+	}
+	var set SeqSet
+	set.AddRange(10, 0)
+	set.AddRange(4, 2)
+	if got := set.String(); got != "10:*,2:4" {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestParseSeqSet(t *testing.T) {
+	for _, s := range []string{"1", "1:3,5", "2:*", "*", "1,3,5:7", "$"} {
+		set, err := ParseSeqSet(s)
+		if err != nil || set.String() != s {
+			t.Errorf("%q: got %q, %v", s, set.String(), err)
+		}
+	}
+	if set, _ := ParseSeqSet("5:3"); set.String() != "3:5" {
+		t.Errorf("5:3: got %q", set.String())
+	}
+	for _, s := range []string{"", "0", "1:", "a", "1,,2", "-1", "4294967296"} {
+		if set, err := ParseSeqSet(s); err == nil {
+			t.Errorf("%q: got %q, want an error", s, set.String())
+		}
+	}
+}
+
+func TestSeqSetContains(t *testing.T) {
+	set, _ := ParseSeqSet("2:4,10:*")
+	for n, want := range map[uint32]bool{1: false, 2: true, 4: true, 5: false, 10: true, 1 << 30: true} {
+		if set.Contains(n) != want {
+			t.Errorf("Contains(%d) = %v", n, !want)
+		}
+	}
+	if NewSeqSet().Contains(1) || SavedResult().Contains(1) {
+		t.Error("empty set contains 1")
+	}
+}
+
+func TestSeqSetAddSet(t *testing.T) {
+	set := NewSeqSet(1, 2)
+	other, _ := ParseSeqSet("3:5,9")
+	set.AddSet(other)
+	if set.String() != "1:5,9" || set.Empty() || !(SeqSet{}).Empty() || SavedResult().Empty() {
+		t.Errorf("got %q", set.String())
+	}
+	if !reflect.DeepEqual(NewUIDSet(1, 2), NewSeqSet(1, 2)) {
+		t.Error("NewUIDSet differs from NewSeqSet")
+	}
+}
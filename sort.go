@@ -0,0 +1,114 @@
+package imap
+
+import (
+	"context"
+	"strings"
+)
+
+// SortKey is a criterion of Sort (RFC 5256).
+type SortKey string
+
+const (
+	// SortArrival orders by internal date.
+	SortArrival SortKey = "ARRIVAL"
+	SortCc      SortKey = "CC"
+	// SortDate orders by the Date header, or the internal date if it has
+	// none.
+	SortDate    SortKey = "DATE"
+	SortFrom    SortKey = "FROM"
+	SortSize    SortKey = "SIZE"
+	SortSubject SortKey = "SUBJECT"
+	SortTo      SortKey = "TO"
+	// SortDisplayFrom and SortDisplayTo order by display name rather than
+	// address, and need the SORT=DISPLAY extension (RFC 5957).
+	SortDisplayFrom SortKey = "DISPLAYFROM"
+	SortDisplayTo   SortKey = "DISPLAYTO"
+)
+
+// Reverse returns key with the order reversed, as in
+// Reverse(SortDate) for the newest first.
+func Reverse(key SortKey) SortKey {
+	return "REVERSE " + key
+}
+
+func (c *IMAPClient) Sort(keys []SortKey, criteria ...interface{}) ([]uint32, error) {
+	return c.SortContext(context.Background(), keys, criteria...)
+}
+
+// SortContext returns the sequence numbers of the messages matching
+// criteria, as for SearchContext, ordered by keys, later keys breaking
+// ties of earlier ones. It needs the SORT extension. Unless criteria start
+// with CHARSET, they are sent as UTF-8.
+func (c *IMAPClient) SortContext(ctx context.Context, keys []SortKey, criteria ...interface{}) ([]uint32, error) {
+	return c.sort(ctx, "SORT", keys, criteria)
+}
+
+// UIDSort is like Sort but returns UIDs.
+func (c *IMAPClient) UIDSort(keys []SortKey, criteria ...interface{}) ([]UID, error) {
+	return c.UIDSortContext(context.Background(), keys, criteria...)
+}
+
+func (c *IMAPClient) UIDSortContext(ctx context.Context, keys []SortKey, criteria ...interface{}) ([]UID, error) {
+	nums, err := c.sort(ctx, "UID SORT", keys, criteria)
+	return toUIDs(nums), err
+}
+
+func (c *IMAPClient) sort(ctx context.Context, cmd string, keys []SortKey, criteria []interface{}) ([]uint32, error) {
+	if err := checkCriteria(criteria); err != nil {
+		return nil, err
+	}
+	resp := c.command(ctx, sortArgs(cmd, keys, criteria)...)
+	if resp.Error() != nil {
+		return nil, resp.Error()
+	}
+	nums, _, err := searchResults(resp, "SORT")
+	return nums, err
+}
+
+func (c *IMAPClient) SortReturn(options []string, keys []SortKey, criteria ...interface{}) (*SearchData, error) {
+	return c.SortReturnContext(context.Background(), options, keys, criteria...)
+}
+
+// SortReturnContext is to SortContext what SearchReturnContext is to
+// SearchContext. All and Partial are in sorted order. It needs the ESORT
+// extension (RFC 5267), and CONTEXT=SORT for SearchUpdate, whose changes
+// give the position in the sorted result.
+func (c *IMAPClient) SortReturnContext(ctx context.Context, options []string, keys []SortKey, criteria ...interface{}) (*SearchData, error) {
+	return c.sortReturn(ctx, "SORT", options, keys, criteria)
+}
+
+// UIDSortReturn is like SortReturn but its results are UIDs.
+func (c *IMAPClient) UIDSortReturn(options []string, keys []SortKey, criteria ...interface{}) (*SearchData, error) {
+	return c.UIDSortReturnContext(context.Background(), options, keys, criteria...)
+}
+
+func (c *IMAPClient) UIDSortReturnContext(ctx context.Context, options []string, keys []SortKey, criteria ...interface{}) (*SearchData, error) {
+	return c.sortReturn(ctx, "UID SORT", options, keys, criteria)
+}
+
+func (c *IMAPClient) sortReturn(ctx context.Context, cmd string, options []string, keys []SortKey, criteria []interface{}) (*SearchData, error) {
+	if err := checkCriteria(criteria); err != nil {
+		return nil, err
+	}
+	return esearchResult(c.command(ctx, sortArgs(cmd+" RETURN ("+strings.Join(options, " ")+")", keys, criteria)...))
+}
+
+// sortArgs returns the arguments of a SORT command.
+func sortArgs(cmd string, keys []SortKey, criteria []interface{}) []interface{} {
+	names := make([]string, len(keys))
+	for i, key := range keys {
+		names[i] = string(key)
+	}
+	return append([]interface{}{cmd, "(" + strings.Join(names, " ") + ")"}, charsetCriteria(criteria)...)
+}
+
+// charsetCriteria returns search criteria led by their charset as SORT and
+// THREAD take it: always present, without the CHARSET keyword.
+func charsetCriteria(criteria []interface{}) []interface{} {
+	if len(criteria) > 1 {
+		if first, ok := criteria[0].(string); ok && strings.EqualFold(first, "CHARSET") {
+			return criteria[1:]
+		}
+	}
+	return append([]interface{}{"UTF-8"}, criteria...)
+}
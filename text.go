@@ -0,0 +1,65 @@
+package imap
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+)
+
+// ErrNoText is returned by FetchText for messages without a text part of
+// the requested types.
+var ErrNoText = errors.New("No text part")
+
+// TextPart returns the number and structure of the first part of bs with
+// one of the given media types that is not an attachment, trying the
+// types in order, or nil if there is none.
+func (bs *BodyStructure) TextPart(mediaTypes ...string) (string, *BodyStructure) {
+	for _, mediaType := range mediaTypes {
+		var number string
+		var found *BodyStructure
+		bs.walk("", func(n string, part *BodyStructure) error {
+			if found == nil && part.MediaType() == mediaType && part.Disposition != "attachment" {
+				number, found = n, part
+			}
+			return nil
+		})
+		if found != nil {
+			return number, found
+		}
+	}
+	return "", nil
+}
+
+func (c *IMAPClient) FetchText(uid UID, mediaTypes ...string) (string, string, error) {
+	return c.FetchTextContext(context.Background(), uid, mediaTypes...)
+}
+
+// FetchTextContext fetches only the preferred rendering of the message
+// with the given UID, by default its text/plain part or, failing that, its
+// text/html part, and returns it decoded to UTF-8 along with its media
+// type. Other parts, such as attachments, are not downloaded and the
+// message is not marked \Seen.
+func (c *IMAPClient) FetchTextContext(ctx context.Context, uid UID, mediaTypes ...string) (string, string, error) {
+	if len(mediaTypes) == 0 {
+		mediaTypes = []string{"text/plain", "text/html"}
+	}
+	bs, err := c.bodyStructure(ctx, uid)
+	if err != nil {
+		return "", "", err
+	}
+	number, part := bs.TextPart(mediaTypes...)
+	if part == nil {
+		return "", "", ErrNoText
+	}
+	data, err := c.fetchPart(ctx, uid, number, part)
+	if err != nil {
+		return "", "", err
+	}
+	r, err := DecodeCharset(part.Params["charset"], bytes.NewReader(data))
+	if err != nil {
+		return "", "", err
+	}
+	text, err := ioutil.ReadAll(r)
+	return string(text), part.MediaType(), err
+}
@@ -0,0 +1,130 @@
+package imap
+
+import (
+	"context"
+	"errors"
+)
+
+// ThreadAlgorithm is an algorithm of Thread (RFC 5256).
+type ThreadAlgorithm string
+
+const (
+	// ThreadOrderedSubject groups messages by base subject, each thread
+	// being a flat list ordered by date.
+	ThreadOrderedSubject ThreadAlgorithm = "ORDEREDSUBJECT"
+	// ThreadReferences builds threads from the Message-ID, In-Reply-To
+	// and References headers.
+	ThreadReferences ThreadAlgorithm = "REFERENCES"
+)
+
+// Thread is a message in a thread tree with its replies. Num is 0 for a
+// message missing from the mailbox or the search whose replies are known.
+type Thread struct {
+	Num      uint32
+	Children []*Thread
+}
+
+// Walk calls fn for t and its descendants in order, with their depth below
+// t.
+func (t *Thread) Walk(fn func(t *Thread, depth int)) {
+	t.walk(fn, 0)
+}
+
+func (t *Thread) walk(fn func(t *Thread, depth int), depth int) {
+	fn(t, depth)
+	for _, child := range t.Children {
+		child.walk(fn, depth+1)
+	}
+}
+
+func (c *IMAPClient) Thread(algorithm ThreadAlgorithm, criteria ...interface{}) ([]*Thread, error) {
+	return c.ThreadContext(context.Background(), algorithm, criteria...)
+}
+
+// ThreadContext returns the messages matching criteria, as for
+// SearchContext, as trees of threads by sequence number. It needs the
+// THREAD extension for the algorithm, such as "THREAD=REFERENCES". Unless
+// criteria start with CHARSET, they are sent as UTF-8.
+func (c *IMAPClient) ThreadContext(ctx context.Context, algorithm ThreadAlgorithm, criteria ...interface{}) ([]*Thread, error) {
+	return c.thread(ctx, "THREAD", algorithm, criteria)
+}
+
+// UIDThread is like Thread but the Num of each Thread is a UID.
+func (c *IMAPClient) UIDThread(algorithm ThreadAlgorithm, criteria ...interface{}) ([]*Thread, error) {
+	return c.UIDThreadContext(context.Background(), algorithm, criteria...)
+}
+
+func (c *IMAPClient) UIDThreadContext(ctx context.Context, algorithm ThreadAlgorithm, criteria ...interface{}) ([]*Thread, error) {
+	return c.thread(ctx, "UID THREAD", algorithm, criteria)
+}
+
+func (c *IMAPClient) thread(ctx context.Context, cmd string, algorithm ThreadAlgorithm, criteria []interface{}) ([]*Thread, error) {
+	if err := checkCriteria(criteria); err != nil {
+		return nil, err
+	}
+	resp := c.command(ctx, append([]interface{}{cmd, string(algorithm)}, charsetCriteria(criteria)...)...)
+	if resp.Error() != nil {
+		return nil, resp.Error()
+	}
+	for _, reply := range resp.Replys() {
+		args, ok := replyArgs(reply, "THREAD")
+		if !ok {
+			continue
+		}
+		fields, err := parseFields(args)
+		if err != nil {
+			continue
+		}
+		threads := []*Thread{}
+		for _, field := range fields {
+			thread, err := parseThread(asList(field))
+			if err != nil {
+				return nil, errors.New("Invalid THREAD response: " + reply.Origin())
+			}
+			threads = append(threads, thread)
+		}
+		return threads, nil
+	}
+	return nil, errors.New("Invalid response")
+}
+
+// parseThread parses a thread such as (3 6 (4 23)(44 7 96)): leading
+// numbers each reply to the one before, and the lists after them are
+// branches replying to the last. Without leading numbers, the branches
+// share a missing parent.
+func parseThread(list []interface{}) (*Thread, error) {
+	if len(list) == 0 {
+		return nil, errors.New("Empty thread")
+	}
+	root := &Thread{}
+	last := root
+	i := 0
+	for ; i < len(list); i++ {
+		if _, ok := list[i].([]interface{}); ok {
+			break
+		}
+		num, ok := asNumber(list[i])
+		if !ok {
+			return nil, errors.New("Invalid thread number")
+		}
+		if i == 0 {
+			root.Num = num
+			continue
+		}
+		child := &Thread{Num: num}
+		last.Children = append(last.Children, child)
+		last = child
+	}
+	for ; i < len(list); i++ {
+		branch, ok := list[i].([]interface{})
+		if !ok {
+			return nil, errors.New("Invalid thread branch")
+		}
+		child, err := parseThread(branch)
+		if err != nil {
+			return nil, err
+		}
+		last.Children = append(last.Children, child)
+	}
+	return root, nil
+}
@@ -0,0 +1,63 @@
+package imap
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// walkString renders t as space-separated num/depth pairs.
+func walkString(t *Thread) string {
+	var parts []string
+	t.Walk(func(t *Thread, depth int) {
+		parts = append(parts, fmt.Sprintf("%d/%d", t.Num, depth))
+	})
+	return strings.Join(parts, " ")
+}
+
+func TestParseThread(t *testing.T) {
+	for _, tt := range []struct {
+		in, want string
+	}{
+		{"(2)", "2/0"},
+		{"(3 6 (4 23)(44 7 96))", "3/0 6/1 4/2 23/3 44/2 7/3 96/4"},
+		{"((3)(5))", "0/0 3/1 5/1"},
+		{"(1 (2 (3)(4)))", "1/0 2/1 3/2 4/2"},
+	} {
+		fields, err := parseFields(tt.in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		thread, err := parseThread(asList(fields[0]))
+		if err != nil {
+			t.Errorf("%s: %v", tt.in, err)
+			continue
+		}
+		if got := walkString(thread); got != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.in, got, tt.want)
+		}
+	}
+	for _, in := range []string{"()", "(1 foo)", "(1 (2) 3)", "(())"} {
+		fields, err := parseFields(in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := parseThread(asList(fields[0])); err == nil {
+			t.Errorf("%s: got no error", in)
+		}
+	}
+}
+
+func TestThread(t *testing.T) {
+	c := testClient(t, "* PREAUTH [CAPABILITY IMAP4rev1 THREAD=REFERENCES] ready", func(s *fakeServer) {
+		tag := s.expect("UID THREAD REFERENCES UTF-8 ALL")
+		s.write("* THREAD (2)(3 6 (4 23)(44 7 96))", tag+" OK done")
+	})
+	threads, err := c.UIDThread(ThreadReferences, "ALL")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(threads) != 2 || walkString(threads[0]) != "2/0" || walkString(threads[1]) != "3/0 6/1 4/2 23/3 44/2 7/3 96/4" {
+		t.Errorf("got %d threads", len(threads))
+	}
+}
@@ -0,0 +1,157 @@
+package imap
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strings"
+)
+
+// TLSPolicy restricts the TLS parameters a Dialer accepts without having to
+// build a complete tls.Config.
+type TLSPolicy struct {
+	// MinVersion and MaxVersion are tls.VersionTLS12 and so on. Zero
+	// leaves the crypto/tls default.
+	MinVersion uint16
+	MaxVersion uint16
+	// CipherSuites limits the TLS 1.0-1.2 cipher suites offered. Nil
+	// leaves the crypto/tls default.
+	CipherSuites []uint16
+	// Strict never lets a session run unencrypted: plaintext dials are
+	// upgraded with STARTTLS and fail if the server refuses it, and the
+	// negotiated version is checked again after the handshake.
+	Strict bool
+}
+
+var (
+	RequireTLS12 = &TLSPolicy{MinVersion: tls.VersionTLS12, Strict: true}
+	RequireTLS13 = &TLSPolicy{MinVersion: tls.VersionTLS13, Strict: true}
+)
+
+// Config returns a copy of config (which may be nil) with the policy
+// applied. A nil policy returns config unchanged.
+func (p *TLSPolicy) Config(config *tls.Config) *tls.Config {
+	if p == nil {
+		return config
+	}
+	if config == nil {
+		config = &tls.Config{}
+	}
+	config = config.Clone()
+	if p.MinVersion != 0 {
+		config.MinVersion = p.MinVersion
+	}
+	if p.MaxVersion != 0 {
+		config.MaxVersion = p.MaxVersion
+	}
+	if p.CipherSuites != nil {
+		config.CipherSuites = p.CipherSuites
+	}
+	if p.Strict {
+		verify := config.VerifyConnection
+		min := config.MinVersion
+		config.VerifyConnection = func(cs tls.ConnectionState) error {
+			if min != 0 && cs.Version < min {
+				return errors.New("Server negotiated " + tls.VersionName(cs.Version) + " below the required minimum")
+			}
+			if verify != nil {
+				return verify(cs)
+			}
+			return nil
+		}
+	}
+	return config
+}
+
+var ErrPinMismatch = errors.New("Server certificate does not match any pinned key")
+
+// PinTLS returns a copy of config (which may be nil) that accepts the server
+// only if its certificate has a SHA-256 fingerprint, or a SHA-256 hash of
+// its SubjectPublicKeyInfo, equal to one of pins. The system trust store
+// and host name are then not consulted. To pin an intermediate or CA
+// instead, the chain the server presents must also verify against
+// config.RootCAs (the system roots if nil) for config.ServerName, or the
+// name dialled, and the pin is looked for in the verified chains. Without
+// either name, only the server certificate can be pinned.
+func PinTLS(config *tls.Config, pins ...[]byte) *tls.Config {
+	if config == nil {
+		config = &tls.Config{}
+	}
+	config = config.Clone()
+	config.InsecureSkipVerify = true
+	roots, serverName := config.RootCAs, config.ServerName
+	config.VerifyConnection = func(cs tls.ConnectionState) error {
+		if len(cs.PeerCertificates) == 0 {
+			return ErrPinMismatch
+		}
+		leaf := cs.PeerCertificates[0]
+		if pinned(leaf, pins) {
+			return nil
+		}
+		intermediates := x509.NewCertPool()
+		for _, cert := range cs.PeerCertificates[1:] {
+			intermediates.AddCert(cert)
+		}
+		name := serverName
+		if name == "" {
+			name = cs.ServerName
+		}
+		if name == "" {
+			// Without a host name, any certificate from the pinned CA
+			// would do.
+			return ErrPinMismatch
+		}
+		chains, err := leaf.Verify(x509.VerifyOptions{
+			Roots:         roots,
+			Intermediates: intermediates,
+			DNSName:       name,
+		})
+		if err != nil {
+			return ErrPinMismatch
+		}
+		for _, chain := range chains {
+			for _, cert := range chain[1:] {
+				if pinned(cert, pins) {
+					return nil
+				}
+			}
+		}
+		return ErrPinMismatch
+	}
+	return config
+}
+
+func pinned(cert *x509.Certificate, pins [][]byte) bool {
+	fingerprint := sha256.Sum256(cert.Raw)
+	spki := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	for _, pin := range pins {
+		if bytes.Equal(pin, fingerprint[:]) || bytes.Equal(pin, spki[:]) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParsePin decodes a pin for PinTLS given either as "sha256/<base64>", the
+// HPKP notation for SPKI hashes, or as a hex fingerprint with optional
+// colons, as printed by openssl x509 -fingerprint -sha256.
+func ParsePin(s string) ([]byte, error) {
+	var pin []byte
+	var err error
+	if strings.HasPrefix(s, "sha256/") {
+		pin, err = base64.StdEncoding.DecodeString(s[len("sha256/"):])
+	} else {
+		pin, err = hex.DecodeString(strings.Replace(s, ":", "", -1))
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(pin) != sha256.Size {
+		return nil, errors.New("Pin is not a SHA-256 hash: " + s)
+	}
+	return pin, nil
+}
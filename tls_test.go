@@ -0,0 +1,90 @@
+package imap
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"testing"
+	"time"
+)
+
+func testCert(t *testing.T, name string, isCA bool, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  isCA,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	if !isCA {
+		template.DNSNames = []string{name}
+	}
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, key
+}
+
+func TestPinTLS(t *testing.T) {
+	ca, caKey := testCert(t, "ca", true, nil, nil)
+	server, _ := testCert(t, "imap.example.com", false, ca, caKey)
+	evil, _ := testCert(t, "imap.example.com", false, nil, nil)
+	roots := x509.NewCertPool()
+	roots.AddCert(ca)
+	serverPin := sha256.Sum256(server.Raw)
+	caPin := sha256.Sum256(ca.RawSubjectPublicKeyInfo)
+
+	tests := []struct {
+		name  string
+		pin   []byte
+		certs []*x509.Certificate
+		ok    bool
+	}{
+		{"leaf", serverPin[:], []*x509.Certificate{server}, true},
+		{"leaf appended", serverPin[:], []*x509.Certificate{evil, server}, false},
+		{"ca", caPin[:], []*x509.Certificate{server, ca}, true},
+		{"ca appended", caPin[:], []*x509.Certificate{evil, ca}, false},
+		{"none", serverPin[:], nil, false},
+	}
+	for _, test := range tests {
+		config := PinTLS(&tls.Config{RootCAs: roots, ServerName: "imap.example.com"}, test.pin)
+		err := config.VerifyConnection(tls.ConnectionState{PeerCertificates: test.certs})
+		if (err == nil) != test.ok {
+			t.Errorf("%s: got %v", test.name, err)
+		}
+	}
+
+	// The name comes from each handshake if config has none, and a CA pin
+	// needs one.
+	config := PinTLS(&tls.Config{RootCAs: roots}, caPin[:])
+	certs := []*x509.Certificate{server, ca}
+	if err := config.VerifyConnection(tls.ConnectionState{PeerCertificates: certs, ServerName: "imap.example.com"}); err != nil {
+		t.Errorf("ca with dialled name: got %v", err)
+	}
+	if err := config.VerifyConnection(tls.ConnectionState{PeerCertificates: certs, ServerName: "other.example.com"}); err == nil {
+		t.Error("ca with another dialled name: got no error")
+	}
+	if err := config.VerifyConnection(tls.ConnectionState{PeerCertificates: certs}); err == nil {
+		t.Error("ca without a name: got no error")
+	}
+}
@@ -0,0 +1,260 @@
+package imap
+
+import (
+	"errors"
+	"net/mail"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Trace is the delivery information in the header of a message, as used
+// to judge where it really came from.
+type Trace struct {
+	// ReturnPath is the envelope sender from the Return-Path header,
+	// without angle brackets. It is empty for bounces.
+	ReturnPath string
+	// Hops are the parsed Received headers in the order the message
+	// travelled, the reverse of their order in the header. Headers that
+	// cannot be parsed are left out.
+	Hops []*Hop
+	// AuthResults are the parsed Authentication-Results headers, the most
+	// recent first. Only those added by servers the reader trusts should be
+	// believed; see AuthServID.
+	AuthResults []*AuthResults
+}
+
+// Hop is one Received header.
+type Hop struct {
+	From string
+	// FromIP is the address the receiving server saw the connection come
+	// from, if it recorded it in brackets after From.
+	FromIP string
+	By     string
+	With   string
+	ID     string
+	For    string
+	// Date is zero if missing or unparsable.
+	Date time.Time
+}
+
+// AuthResults is an Authentication-Results header (RFC 8601).
+type AuthResults struct {
+	// AuthServID identifies the server that did the checks.
+	AuthServID string
+	Results    []*AuthResult
+}
+
+// AuthResult is the result of one check, as in "dkim=pass
+// header.d=example.com".
+type AuthResult struct {
+	// Method and Result are lower cased, as in "spf" and "pass".
+	Method string
+	Result string
+	Reason string
+	// Props maps property names, as in "smtp.mailfrom" or "header.d", to
+	// their values.
+	Props map[string]string
+}
+
+// Result returns the result of the first check with the given method,
+// such as "dmarc", or "" if there is none.
+func (a *AuthResults) Result(method string) string {
+	for _, r := range a.Results {
+		if r.Method == strings.ToLower(method) {
+			return r.Result
+		}
+	}
+	return ""
+}
+
+// ParseTrace parses the Return-Path, Received and Authentication-Results
+// headers of h.
+func ParseTrace(h mail.Header) *Trace {
+	t := &Trace{ReturnPath: strings.Trim(strings.TrimSpace(h.Get("Return-Path")), "<>")}
+	received := h["Received"]
+	for i := len(received) - 1; i >= 0; i-- {
+		if hop, err := ParseReceived(received[i]); err == nil {
+			t.Hops = append(t.Hops, hop)
+		}
+	}
+	for _, value := range h["Authentication-Results"] {
+		if ar, err := ParseAuthResults(value); err == nil {
+			t.AuthResults = append(t.AuthResults, ar)
+		}
+	}
+	return t
+}
+
+var bracketedIP = regexp.MustCompile(`\[(?:IPv6:)?([0-9A-Fa-f:.]+)\]`)
+
+// ParseReceived parses the value of a Received header.
+func ParseReceived(value string) (*Hop, error) {
+	hop := &Hop{}
+	if i := strings.LastIndexByte(value, ';'); i >= 0 {
+		if date, err := mail.ParseDate(strings.TrimSpace(stripComments(value[i+1:]))); err == nil {
+			hop.Date = date
+		}
+		value = value[:i]
+	}
+	tokens := traceTokens(value)
+	var clause *string
+	for _, token := range tokens {
+		if strings.HasPrefix(token, "(") {
+			if clause == &hop.From && hop.FromIP == "" {
+				if m := bracketedIP.FindStringSubmatch(token); m != nil {
+					hop.FromIP = m[1]
+				}
+			}
+			continue
+		}
+		switch strings.ToLower(token) {
+		case "from":
+			clause = &hop.From
+		case "by":
+			clause = &hop.By
+		case "with":
+			clause = &hop.With
+		case "id":
+			clause = &hop.ID
+		case "for":
+			clause = &hop.For
+		case "via":
+			clause = nil
+		default:
+			if clause != nil && *clause == "" {
+				*clause = strings.Trim(token, "<>")
+			}
+		}
+	}
+	if hop.From == "" && hop.By == "" {
+		return nil, errors.New("Invalid Received header")
+	}
+	return hop, nil
+}
+
+// ParseAuthResults parses the value of an Authentication-Results header.
+func ParseAuthResults(value string) (*AuthResults, error) {
+	parts := splitQuoted(stripComments(value), ';')
+	fields := strings.Fields(parts[0])
+	if len(fields) == 0 {
+		return nil, errors.New("Invalid Authentication-Results header")
+	}
+	ar := &AuthResults{AuthServID: fields[0]}
+	for _, part := range parts[1:] {
+		fields := splitQuoted(strings.TrimSpace(part), ' ')
+		if len(fields) == 0 || fields[0] == "" || strings.EqualFold(fields[0], "none") {
+			continue
+		}
+		method := strings.SplitN(fields[0], "=", 2)
+		if len(method) != 2 {
+			return nil, errors.New("Invalid Authentication-Results method " + fields[0])
+		}
+		result := &AuthResult{
+			Method: strings.ToLower(strings.SplitN(method[0], "/", 2)[0]),
+			Result: strings.ToLower(method[1]),
+			Props:  make(map[string]string),
+		}
+		for _, field := range fields[1:] {
+			kv := strings.SplitN(field, "=", 2)
+			if len(kv) != 2 {
+				continue
+			}
+			v := strings.Trim(kv[1], `"`)
+			if strings.EqualFold(kv[0], "reason") {
+				result.Reason = v
+			} else {
+				result.Props[strings.ToLower(kv[0])] = v
+			}
+		}
+		ar.Results = append(ar.Results, result)
+	}
+	return ar, nil
+}
+
+// traceTokens splits s at white space, keeping comments, which may nest,
+// as single tokens.
+func traceTokens(s string) []string {
+	var tokens []string
+	start, depth := -1, 0
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '(':
+			if depth == 0 {
+				if start >= 0 {
+					tokens = append(tokens, s[start:i])
+				}
+				start = i
+			}
+			depth++
+		case c == ')' && depth > 0:
+			depth--
+			if depth == 0 {
+				tokens = append(tokens, s[start:i+1])
+				start = -1
+			}
+		case depth == 0 && (c == ' ' || c == '\t' || c == '\r' || c == '\n'):
+			if start >= 0 {
+				tokens = append(tokens, s[start:i])
+				start = -1
+			}
+		case start < 0:
+			start = i
+		}
+	}
+	if start >= 0 {
+		tokens = append(tokens, s[start:])
+	}
+	return tokens
+}
+
+// stripComments removes the parenthesized comments in s, except within
+// quoted strings.
+func stripComments(s string) string {
+	var b strings.Builder
+	depth, quoted := 0, false
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quoted:
+			if c == '\\' && i+1 < len(s) {
+				b.WriteByte(c)
+				i++
+				c = s[i]
+			} else if c == '"' {
+				quoted = false
+			}
+		case c == '(':
+			depth++
+			continue
+		case c == ')' && depth > 0:
+			depth--
+			continue
+		case depth > 0:
+			continue
+		case c == '"':
+			quoted = true
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
+
+// splitQuoted splits s at sep outside quoted strings, dropping empty
+// fields when sep is a space.
+func splitQuoted(s string, sep byte) []string {
+	var fields []string
+	start, quoted := 0, false
+	for i := 0; i <= len(s); i++ {
+		if i < len(s) && s[i] == '"' {
+			quoted = !quoted
+		}
+		if i == len(s) || !quoted && (s[i] == sep || sep == ' ' && (s[i] == '\t' || s[i] == '\r' || s[i] == '\n')) {
+			if field := s[start:i]; sep != ' ' || field != "" {
+				fields = append(fields, field)
+			}
+			start = i + 1
+		}
+	}
+	return fields
+}
@@ -0,0 +1,86 @@
+package imap
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// Mailbox names are sent in the modified UTF-7 of RFC 3501 section 5.1.3.
+var utf7Encoding = base64.NewEncoding("ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+,").WithPadding(base64.NoPadding)
+
+// EncodeMailbox converts a UTF-8 mailbox name to modified UTF-7.
+func EncodeMailbox(name string) string {
+	var b strings.Builder
+	var run []rune
+	flush := func() {
+		if len(run) == 0 {
+			return
+		}
+		units := utf16.Encode(run)
+		buf := make([]byte, 0, 2*len(units))
+		for _, u := range units {
+			buf = append(buf, byte(u>>8), byte(u))
+		}
+		b.WriteByte('&')
+		b.WriteString(utf7Encoding.EncodeToString(buf))
+		b.WriteByte('-')
+		run = run[:0]
+	}
+	for _, r := range name {
+		if r >= 0x20 && r <= 0x7e {
+			flush()
+			if r == '&' {
+				b.WriteString("&-")
+			} else {
+				b.WriteRune(r)
+			}
+		} else {
+			run = append(run, r)
+		}
+	}
+	flush()
+	return b.String()
+}
+
+// DecodeMailbox converts a modified UTF-7 mailbox name to UTF-8.
+func DecodeMailbox(name string) (string, error) {
+	var b strings.Builder
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if c != '&' {
+			if c < 0x20 || c > 0x7e {
+				return "", errors.New("Invalid character in mailbox name")
+			}
+			b.WriteByte(c)
+			continue
+		}
+		end := strings.IndexByte(name[i:], '-')
+		if end < 0 {
+			return "", errors.New("Unterminated UTF-7 sequence in mailbox name")
+		}
+		if end == 1 {
+			b.WriteByte('&')
+			i++
+			continue
+		}
+		buf, err := utf7Encoding.DecodeString(name[i+1 : i+end])
+		if err != nil || len(buf)%2 != 0 {
+			return "", errors.New("Invalid UTF-7 sequence in mailbox name")
+		}
+		units := make([]uint16, len(buf)/2)
+		for j := range units {
+			units[j] = uint16(buf[2*j])<<8 | uint16(buf[2*j+1])
+		}
+		for _, r := range utf16.Decode(units) {
+			if r == utf8.RuneError {
+				return "", errors.New("Invalid UTF-16 in mailbox name")
+			}
+			b.WriteRune(r)
+		}
+		i += end
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,40 @@
+package imap
+
+import "testing"
+
+func TestMailboxUTF7(t *testing.T) {
+	tests := []struct {
+		name, encoded string
+	}{
+		{"INBOX", "INBOX"},
+		{"A&B", "A&-B"},
+		{"Grüße", "Gr&APwA3w-e"},
+		{"~peter/mail/台北/日本語", "~peter/mail/&U,BTFw-/&ZeVnLIqe-"},
+		{"Entwürfe & Vorlagen", "Entw&APw-rfe &- Vorlagen"},
+		{"😀", "&2D3eAA-"},
+		{"a\tb", "a&AAk-b"},
+		{"", ""},
+	}
+	for _, test := range tests {
+		if encoded := EncodeMailbox(test.name); encoded != test.encoded {
+			t.Errorf("EncodeMailbox(%q) = %q, want %q", test.name, encoded, test.encoded)
+		}
+		if name, err := DecodeMailbox(test.encoded); err != nil || name != test.name {
+			t.Errorf("DecodeMailbox(%q) = %q, %v, want %q", test.encoded, name, err, test.name)
+		}
+	}
+}
+
+func TestDecodeMailboxErrors(t *testing.T) {
+	for _, encoded := range []string{
+		"&U,BTFw", // unterminated
+		"&U,BT-",  // odd number of bytes
+		"&2D0-",   // lone surrogate
+		"a\x80b",  // 8-bit
+		"&A!A-",   // not base64
+	} {
+		if name, err := DecodeMailbox(encoded); err == nil {
+			t.Errorf("DecodeMailbox(%q) = %q, want an error", encoded, name)
+		}
+	}
+}